@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Renames that were edited and wait to be confirmed, shown in place of the tree
+type renamePreview struct {
+	renames []ctx.RenamePair // The renames as they were edited, in the order of the list
+	steps   []ctx.RenamePair // The renames in the order they are made, with the temporary names that break cycles
+	scroll  int              // Index of the first rename shown
+}
+
+// Returns the command that edits a file with $VISUAL or $EDITOR, or vi if neither is set
+func editorCommand(file string) *exec.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		args = []string{"vi"}
+	}
+	return exec.Command(args[0], append(args[1:], file)...)
+}
+
+// Edit the names of the marked items, or of every item in the current directory if none are marked,
+// in an editor. The renames are shown to be confirmed before they are made.
+func (s *Screen) startBulkRename() {
+	if !s.checkLocal() {
+		return
+	}
+	paths := s.markedPaths()
+	if len(paths) == 0 {
+		for _, f := range s.CurrentDir.Files {
+			paths = append(paths, path.Join(s.CurrentDir.AbsPath, f.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		s.setError(errors.New("no items to rename"))
+		return
+	}
+
+	// Items are listed one per line, relative to the current directory
+	var lines []string
+	for _, p := range paths {
+		if strings.ContainsAny(p, "\n\r") {
+			s.setError(fmt.Errorf("%q has a line break in its name", p))
+			return
+		}
+		rel, err := filepath.Rel(s.CurrentDir.AbsPath, p)
+		if err != nil {
+			rel = p
+		}
+		lines = append(lines, rel)
+	}
+	f, err := ioutil.TempFile("", "itree-rename-*.txt")
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(strings.Join(lines, "\n") + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		s.setError(err)
+		return
+	}
+
+	if err := s.renderer.RunProgram(editorCommand(f.Name())); err != nil {
+		s.setError(fmt.Errorf("editor: %v", err))
+		return
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	renames, err := parseRenames(s.CurrentDir.AbsPath, paths, string(data))
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	steps, err := ctx.PlanRenames(renames)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	if len(steps) == 0 {
+		s.setStatus("No names were changed")
+		return
+	}
+	s.overlay = &renamePreview{renames: renames, steps: steps}
+}
+
+// Pair the items with the lines of the edited list. The list must have a line for every item,
+// in the same order. Paths are relative to dir.
+func parseRenames(dir string, paths []string, edited string) ([]ctx.RenamePair, error) {
+	lines := strings.Split(strings.TrimRight(strings.Replace(edited, "\r\n", "\n", -1), "\n"), "\n")
+	if len(lines) != len(paths) {
+		return nil, fmt.Errorf("the list has %d lines instead of %d, lines cannot be added or removed", len(lines), len(paths))
+	}
+	var renames []ctx.RenamePair
+	for ii, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			return nil, fmt.Errorf("line %d is empty", ii+1)
+		}
+		dst := line
+		if !filepath.IsAbs(dst) {
+			dst = filepath.Join(dir, dst)
+		}
+		if filepath.Clean(dst) != filepath.Clean(paths[ii]) {
+			renames = append(renames, ctx.RenamePair{Src: paths[ii], Dst: dst})
+		}
+	}
+	return renames, nil
+}
+
+// Returns the number of renames in the cycle that the rename is part of, 0 if it is not in one
+func cycleLength(renames []ctx.RenamePair, ii int) int {
+	next := make(map[string]string)
+	for _, r := range renames {
+		next[filepath.Clean(r.Src)] = filepath.Clean(r.Dst)
+	}
+	start := filepath.Clean(renames[ii].Src)
+	p := start
+	for n := 1; n <= len(renames); n++ {
+		dst, ok := next[p]
+		if !ok {
+			return 0
+		}
+		if dst == start {
+			return n
+		}
+		p = dst
+	}
+	return 0
+}
+
+// Draws the renames that wait to be confirmed
+func (preview *renamePreview) draw(s *Screen, y0 int) {
+	screenWidth, screenHeight := s.renderer.Size()
+	rows := screenHeight - y0 - 1
+
+	status := fmt.Sprintf("Rename %s? y renames them and n cancels", describeItems(pairSources(preview.renames)))
+	s.Print(0, y0, termbox.ColorWhite, termbox.ColorDefault, truncate(status, screenWidth))
+	for ii := preview.scroll; ii < len(preview.renames) && ii-preview.scroll < rows; ii++ {
+		r := preview.renames[ii]
+		src, _ := filepath.Rel(s.CurrentDir.AbsPath, r.Src)
+		dst, _ := filepath.Rel(s.CurrentDir.AbsPath, filepath.Clean(r.Dst))
+		label := fmt.Sprintf("%s -> %s", src, dst)
+		switch n := cycleLength(preview.renames, ii); {
+		case n == 2:
+			label += "  (swap)"
+		case n > 2:
+			label += fmt.Sprintf("  (cycle of %d)", n)
+		}
+		s.Print(2, y0+1+ii-preview.scroll, s.fileColor, termbox.ColorDefault, truncate(label, screenWidth-2))
+	}
+}
+
+// Returns the items that are renamed
+func pairSources(renames []ctx.RenamePair) []string {
+	var paths []string
+	for _, r := range renames {
+		paths = append(paths, r.Src)
+	}
+	return paths
+}
+
+// Handle a key while the renames are shown to be confirmed
+func (preview *renamePreview) handleKey(s *Screen, ev termbox.Event) {
+	if scroll, ok := listKey(ev, preview.scroll, len(preview.renames)); ok {
+		preview.scroll = scroll
+		return
+	}
+	switch {
+	case ev.Ch == 'y' || ev.Ch == 'Y':
+		s.overlay = nil
+		preview.apply(s)
+	case ev.Ch == 'n' || ev.Ch == 'N' || ev.Ch == 'q' || ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlC:
+		s.overlay = nil
+		s.setStatus("Renaming was cancelled")
+	}
+}
+
+// Make the renames that were confirmed, all of them or none if one fails
+func (preview *renamePreview) apply(s *Screen) {
+	if err := ctx.ApplyRenames(preview.steps); err != nil {
+		s.setError(err)
+		return
+	}
+	var changed []string
+	var ops []operation
+	for _, r := range preview.steps {
+		changed = append(changed, r.Src, r.Dst)
+		ops = append(ops, operation{Kind: opMove, Src: r.Src, Dst: r.Dst})
+		s.unmark(r.Src)
+	}
+	s.refreshItems(changed)
+	done := fmt.Sprintf("Renamed %s", describeItems(pairSources(preview.renames)))
+	s.setStatus(done)
+	s.journalOperations(done, ops)
+}
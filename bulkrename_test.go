@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBulkRename(t *testing.T) {
+	s, root := fileOpsScreen(t, "a", "b", "c", "dir/")
+	for _, name := range []string{"a", "b", "c"} {
+		ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644)
+	}
+	// The editor swaps a and b and renames c to d
+	setEnv(t, "VISUAL", "")
+	setEnv(t, "EDITOR", "sed -i -e s/^a$/b/ -e t -e s/^b$/a/ -e s/^c$/d/")
+
+	press(t, s, "R")
+	if preview, ok := s.overlay.(*renamePreview); !ok || len(preview.renames) != 3 {
+		t.Fatal(fmt.Sprintf("Expected 3 renames to be shown, found %+v, status %q", s.overlay, s.status))
+	}
+	s.draw()
+	screen := s.renderer.(*memRenderer).String()
+	for _, line := range []string{"Rename 3 items?", "a -> b  (swap)", "b -> a  (swap)", "c -> d"} {
+		if !strings.Contains(screen, line) {
+			t.Error(fmt.Sprintf("Expected the preview to show %q, found\n%s", line, screen))
+		}
+	}
+
+	press(t, s, "y")
+	for name, contents := range map[string]string{"a": "b", "b": "a", "d": "c"} {
+		if data, _ := ioutil.ReadFile(filepath.Join(root, name)); string(data) != contents {
+			t.Error(fmt.Sprintf("Expected %s to contain %s, found %q", name, contents, data))
+		}
+	}
+	if s.overlay != nil || s.status != "Renamed 3 items" {
+		t.Error(fmt.Sprintf("Expected the renames to be made, found status %q", s.status))
+	}
+
+	// The renames are undone together
+	press(t, s, "u")
+	for _, name := range []string{"a", "b", "c"} {
+		if data, _ := ioutil.ReadFile(filepath.Join(root, name)); string(data) != name {
+			t.Error(fmt.Sprintf("Expected %s to be renamed back, found %q", name, data))
+		}
+	}
+
+	// Cancelling leaves the names
+	press(t, s, "Rn")
+	if _, err := os.Stat(filepath.Join(root, "c")); err != nil || s.overlay != nil {
+		t.Error(fmt.Sprintf("Expected n to cancel the renames, found %v", err))
+	}
+}
+
+func TestParseRenames(t *testing.T) {
+	paths := []string{"/x/a", "/x/b", "/x/sub/c"}
+	cases := []struct {
+		edited   string
+		expected string
+		err      string
+	}{
+		{"a\nb\nsub/c\n", "[]", ""},
+		{"a\nB\nc", "[{/x/b /x/B} {/x/sub/c /x/c}]", ""},
+		{"a\r\nb\r\n/y/c\r\n", "[{/x/sub/c /y/c}]", ""},
+		{"a\nb\n", "", "2 lines instead of 3"},
+		{"a\n\nc\n", "", "line 2 is empty"},
+	}
+	for _, c := range cases {
+		renames, err := parseRenames("/x", paths, c.edited)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Error(fmt.Sprintf("%q: Expected an error containing %q, found %v", c.edited, c.err, err))
+			}
+		} else if fmt.Sprint(renames) != c.expected && !(c.expected == "[]" && len(renames) == 0) {
+			t.Error(fmt.Sprintf("%q: Expected %s, found %v, %v", c.edited, c.expected, renames, err))
+		}
+	}
+}
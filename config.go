@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Config is the configuration of itree, read from $XDG_CONFIG_HOME/itree/config.json.
+// Settings that are missing from the file keep their default values.
+type Config struct {
+	Theme     string      `json:"theme"`      // Built-in theme: default, mono, solarized or gruvbox
+	Colors    ColorConfig `json:"colors"`     // Colors that replace those of the theme
+	ColorMode string      `json:"color_mode"` // Colors the terminal can show: auto, 16, 256 or truecolor
+	LSColors  bool        `json:"ls_colors"`  // Color files by the LS_COLORS environment variable, like ls
+
+	MaxLevelWidth     int               `json:"max_level_width"`     // Longest name shown in the levels above the current directory, 0 for no limit
+	MaxUpperLevels    int               `json:"max_upper_levels"`    // Number of levels shown above the current directory
+	ScrollMargin      int               `json:"scroll_margin"`       // Rows kept visible above and below the selected item when scrolling
+	EnterLastSelected bool              `json:"enter_last_selected"` // Exit into the selected directory rather than the current one
+	ShowHidden        bool              `json:"show_hidden"`         // Show hidden files on start up
+	Sort              string            `json:"sort"`                // Order that files are listed in: name, size, mtime, extension or type
+	SortDescending    bool              `json:"sort_descending"`
+	Keymap            string            `json:"keymap"`          // Preset of key bindings: default, vim or emacs
+	Keys              map[string]string `json:"keys"`            // Key sequences that replace the preset's bindings of an action, by the name of the action
+	PersistJournal    bool              `json:"persist_journal"` // Keep the changes that can be undone in $XDG_STATE_HOME/itree/journal.json between sessions
+}
+
+// ColorConfig are the colors that items are drawn with, written as they are parsed by parseColor,
+// for example "bold cyan" or "#ff8700". Colors that are empty are taken from the theme.
+type ColorConfig struct {
+	Highlighted string `json:"highlighted"` // The selected item
+	Filtered    string `json:"filtered"`    // Items that match the filter
+	Marked      string `json:"marked"`
+	Directory   string `json:"directory"`
+	File        string `json:"file"`
+}
+
+// Returns the configuration that is used when there is no config file
+func defaultConfig() Config {
+	return Config{
+		Theme:          "default",
+		ColorMode:      "auto",
+		LSColors:       true,
+		MaxLevelWidth:  15,
+		MaxUpperLevels: 3,
+		ScrollMargin:   3,
+		Sort:           "name",
+		Keymap:         "default",
+		Keys:           make(map[string]string),
+	}
+}
+
+// Returns the path of the config file. ITREE_CONFIG overrides the default location.
+func configPath() string {
+	if p := os.Getenv("ITREE_CONFIG"); p != "" {
+		return p
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "itree", "config.json")
+}
+
+// Read the config file on top of the defaults. A missing file is not an error.
+func readConfig(path string) (Config, error) {
+	c := defaultConfig()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return c, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Override the configuration with the preferences set in the environment
+func (c *Config) applyEnv(getenv func(string) string) error {
+	if v := getenv("MaxUpperLevels"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("MaxUpperLevels: %q is not a number", v)
+		}
+		c.MaxUpperLevels = n
+	}
+	if v := getenv("EnterLastSelected"); v != "" {
+		c.EnterLastSelected = v == "1"
+	}
+	return c.validate()
+}
+
+// Check that the configuration is valid, the error names the setting that is not
+func (c *Config) validate() error {
+	if c.MaxLevelWidth < 0 {
+		return fmt.Errorf("max_level_width: must be 0 or more, found %d", c.MaxLevelWidth)
+	}
+	if c.MaxLevelWidth > 0 && c.MaxLevelWidth < 4 {
+		return fmt.Errorf("max_level_width: must be 0 (no limit) or at least 4, found %d", c.MaxLevelWidth)
+	}
+	if c.MaxUpperLevels < 0 {
+		return fmt.Errorf("max_upper_levels: must be 0 or more, found %d", c.MaxUpperLevels)
+	}
+	if c.ScrollMargin < 0 {
+		return fmt.Errorf("scroll_margin: must be 0 or more, found %d", c.ScrollMargin)
+	}
+	if _, err := ctx.ParseSortMode(c.Sort); err != nil {
+		return fmt.Errorf("sort: %v", err)
+	}
+	if _, err := c.theme(); err != nil {
+		return err
+	}
+	switch c.ColorMode {
+	case "auto", "16", "256", "truecolor":
+	default:
+		return fmt.Errorf("color_mode: unknown color mode %q, expected auto, 16, 256 or truecolor", c.ColorMode)
+	}
+	_, err := newKeymap(c.Keymap, c.Keys)
+	return err
+}
+
+// Returns the theme with the colors of the config replacing those of the built-in theme
+func (c *Config) theme() (Theme, error) {
+	theme, err := builtinTheme(c.Theme)
+	if err != nil {
+		return theme, fmt.Errorf("theme: %v", err)
+	}
+	colors := []struct {
+		name  string
+		value string
+		color *Color
+	}{
+		{"highlighted", c.Colors.Highlighted, &theme.Highlighted},
+		{"filtered", c.Colors.Filtered, &theme.Filtered},
+		{"marked", c.Colors.Marked, &theme.Marked},
+		{"directory", c.Colors.Directory, &theme.Directory},
+		{"file", c.Colors.File, &theme.File},
+	}
+	for _, color := range colors {
+		if color.value == "" {
+			continue
+		}
+		if *color.color, err = parseColor(color.value); err != nil {
+			return theme, fmt.Errorf("colors.%s: %v", color.name, err)
+		}
+	}
+	return theme, nil
+}
+
+// Apply the configuration to the screen and the directory chain
+func (s *Screen) applyConfig(c Config) {
+	s.maxLevelWidth = c.MaxLevelWidth
+	s.maxUpperLevels = c.MaxUpperLevels
+	s.scrollMargin = c.ScrollMargin
+	s.enterLastSelected = c.EnterLastSelected
+	// The configuration has been validated so none of these fail
+	s.theme, _ = c.theme()
+	s.keymap, _ = newKeymap(c.Keymap, c.Keys)
+	s.lsColors = nil
+	if ls := os.Getenv("LS_COLORS"); c.LSColors && ls != "" {
+		s.lsColors = parseLSColors(ls)
+	}
+	if c.PersistJournal {
+		j, err := readJournal(journalPath())
+		if err != nil {
+			s.setError(fmt.Errorf("reading the journal: %v", err))
+		}
+		s.journal = j
+	}
+	// Colors are shown with 16 colors until the terminal is initialized
+	s.setOutputMode(termbox.OutputNormal)
+
+	mode, _ := ctx.ParseSortMode(c.Sort)
+	for dir := s.CurrentDir; dir != nil; dir = dir.Parent {
+		dir.ShowHidden = c.ShowHidden
+		dir.SortMode = mode
+		dir.SortDesc = c.SortDescending
+		dir.UpdateContents()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Write a config file to a temporary directory and return its path
+func writeConfig(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadConfig(t *testing.T) {
+	c, err := readConfig(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme, _ := c.theme(); c.MaxUpperLevels != 3 || theme.Directory.index != 3 || c.Keymap != "default" {
+		t.Error(fmt.Sprintf("Expected the defaults without a config file, found %+v", c))
+	}
+
+	path := writeConfig(t, `{"colors": {"file": "bold blue"}, "max_upper_levels": 5, "keys": {"toggle-hidden": "."}}`)
+	if c, err = readConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxUpperLevels != 5 || c.Colors.File != "bold blue" || c.Keys["toggle-hidden"] != "." {
+		t.Error(fmt.Sprintf("Expected the settings from the file, found %+v", c))
+	}
+	// Settings that are not in the file keep their defaults
+	if theme, _ := c.theme(); theme.Directory.index != 3 || c.Keymap != "default" {
+		t.Error(fmt.Sprintf("Expected the defaults for missing settings, found %+v", c))
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	cases := []struct {
+		contents string
+		expected string
+	}{
+		{`{"max_upper_levels": "3"}`, "max_upper_levels"},
+		{`{"unknown_setting": 1}`, "unknown_setting"},
+		{`{"max_upper_levels": -1}`, "max_upper_levels: must be 0 or more"},
+		{`{"max_level_width": 2}`, "max_level_width"},
+		{`{"scroll_margin": -2}`, "scroll_margin: must be 0 or more"},
+		{`{"sort": "random"}`, `sort: unknown sort mode "random"`},
+		{`{"colors": {"file": "purple"}}`, `colors.file: unknown color "purple"`},
+		{`{"colors": {"file": "blinking red"}}`, `colors.file: unknown attribute "blinking"`},
+		{`{"colors": {"file": "#12345"}}`, `colors.file: invalid color "#12345"`},
+		{`{"colors": {"file": "color256"}}`, `colors.file: invalid color "color256"`},
+		{`{"theme": "neon"}`, `theme: unknown theme "neon"`},
+		{`{"color_mode": "88"}`, `color_mode: unknown color mode "88"`},
+		{`{"keys": {"quit": "<Nope>"}}`, "keys.quit: unknown key <Nope>"},
+		{`{"keymap": "nano"}`, `keymap: unknown preset "nano"`},
+		{`{"keys": {"quit": "h"}}`, "already bound"},
+		{`{"keys": {"fly": "f"}}`, `unknown action "fly"`},
+	}
+	for _, c := range cases {
+		path := writeConfig(t, c.contents)
+		_, err := readConfig(path)
+		if err == nil || !strings.Contains(err.Error(), c.expected) || !strings.HasPrefix(err.Error(), path) {
+			t.Error(fmt.Sprintf("Expected an error about %q for %s, found %v", c.expected, c.contents, err))
+		}
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	env := map[string]string{"MaxUpperLevels": "7", "EnterLastSelected": "1"}
+	c := defaultConfig()
+	if err := c.applyEnv(func(key string) string { return env[key] }); err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxUpperLevels != 7 || !c.EnterLastSelected {
+		t.Error(fmt.Sprintf("Expected the environment to override the config, found %+v", c))
+	}
+
+	env["MaxUpperLevels"] = "many"
+	if err := c.applyEnv(func(key string) string { return env[key] }); err == nil {
+		t.Error("Expected an error for an invalid MaxUpperLevels")
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/.hidden": &fstest.MapFile{},
+		"dir/small":   &fstest.MapFile{Data: []byte("a")},
+		"dir/large":   &fstest.MapFile{Data: []byte("abc")},
+	}
+	dir, err := ctx.NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := defaultConfig()
+	c.ShowHidden = true
+	c.Sort = "size"
+	c.SortDescending = true
+	c.Colors.File = "underline red"
+	c.Keys["toggle-hidden"] = "H"
+
+	s := Screen{CurrentDir: dir}
+	s.applyConfig(c)
+	var names []string
+	for _, f := range dir.Files {
+		names = append(names, f.Name())
+	}
+	if expected := "[large small .hidden]"; fmt.Sprint(names) != expected {
+		t.Error(fmt.Sprintf("Expected %s, found %s", expected, names))
+	}
+	if s.fileColor != termbox.ColorRed|termbox.AttrUnderline {
+		t.Error(fmt.Sprintf("Expected the file color to be underlined red, found %v", s.fileColor))
+	}
+	if name, _ := s.keymap.lookup([]string{"h"}); name != "" {
+		t.Error(fmt.Sprintf("Expected h to be unbound, found %s", name))
+	}
+	if name, _ := s.keymap.lookup([]string{"H"}); name != "toggle-hidden" {
+		t.Error("Expected H to toggle hidden files instead of h")
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	for _, key := range []string{"ITREE_CONFIG", "XDG_CONFIG_HOME"} {
+		defer os.Setenv(key, os.Getenv(key))
+	}
+	os.Setenv("ITREE_CONFIG", "")
+	os.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if p := configPath(); p != "/xdg/itree/config.json" {
+		t.Error(fmt.Sprintf("Expected /xdg/itree/config.json, found %s", p))
+	}
+	os.Setenv("ITREE_CONFIG", "/other.json")
+	if p := configPath(); p != "/other.json" {
+		t.Error(fmt.Sprintf("Expected /other.json, found %s", p))
+	}
+}
@@ -0,0 +1,387 @@
+package ctx
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveSep separates the path of an archive from the path of an entry inside of it.
+// eg. /home/user/archive.zip!/inner/path
+const ArchiveSep = "!"
+
+// ArchiveFormat identifies the type of an archive by its file extension
+type ArchiveFormat int
+
+const (
+	NotArchive ArchiveFormat = iota
+	Zip
+	Tar
+	TarGz
+)
+
+// Returns the archive format of a file based on its name
+func GetArchiveFormat(name string) ArchiveFormat {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return Zip
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return TarGz
+	case strings.HasSuffix(lower, ".tar"):
+		return Tar
+	}
+	return NotArchive
+}
+
+// Returns true if the file can be browsed as an archive
+func IsArchive(name string) bool {
+	return GetArchiveFormat(name) != NotArchive
+}
+
+// Open the archive at name within fsys and return a file system of its contents
+func OpenArchive(fsys fs.FS, name string) (fs.FS, error) {
+	switch GetArchiveFormat(name) {
+	case Zip:
+		return openZip(fsys, name)
+	case Tar, TarGz:
+		return openTar(fsys, name)
+	}
+	return nil, fmt.Errorf("%s is not a supported archive", path.Base(name))
+}
+
+func openZip(fsys fs.FS, name string) (fs.FS, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Files on disk can be read at random, anything else has to be loaded into memory.
+	// The file is left open for as long as the archive is being browsed.
+	if r, ok := f.(io.ReaderAt); ok {
+		zr, err := zip.NewReader(r, info.Size())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &zipFS{Reader: zr, file: f}, nil
+	}
+	defer f.Close()
+	contents, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+}
+
+// zipFS is the file system of a zip archive that is read from an open file, which is closed
+// when the archive is left
+type zipFS struct {
+	*zip.Reader
+	file io.Closer
+}
+
+func (z *zipFS) Close() error { return z.file.Close() }
+
+/*
+Tar archives
+*/
+
+// tarFS is a read-only file system of the contents of a tar archive.
+// Only the headers are kept in memory, the archive is re-read to open a file. A path that is stored
+// more than once is the last entry with that path, as tar extracts it.
+type tarFS struct {
+	fsys    fs.FS
+	name    string
+	entries map[string]*tarEntry
+}
+
+type tarEntry struct {
+	name     string
+	header   *tar.Header // nil for directories that are implied by the path of another entry
+	index    int         // Position of the header in the archive
+	children []*tarEntry
+}
+
+func openTar(fsys fs.FS, name string) (fs.FS, error) {
+	t := &tarFS{fsys: fsys, name: name, entries: make(map[string]*tarEntry)}
+	t.entries["."] = &tarEntry{name: "."}
+
+	index := -1
+	err := t.scan(func(hdr *tar.Header, r io.Reader) bool {
+		index++
+		p := fsPath(hdr.Name)
+		if p == "." {
+			return false
+		}
+		e := t.entry(p)
+		e.header, e.index = hdr, index
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range t.entries {
+		sort.Slice(e.children, func(i, j int) bool { return e.children[i].name < e.children[j].name })
+	}
+	return t, nil
+}
+
+// Get or create the entry with the given path, creating any parent directories along the way
+func (t *tarFS) entry(p string) *tarEntry {
+	if e, ok := t.entries[p]; ok {
+		return e
+	}
+	e := &tarEntry{name: path.Base(p)}
+	t.entries[p] = e
+	parent := t.entry(path.Dir(p))
+	parent.children = append(parent.children, e)
+	return e
+}
+
+// Open the archive for reading from its first entry. The returned function closes the archive.
+func (t *tarFS) open() (*tar.Reader, func(), error) {
+	f, err := t.fsys.Open(t.name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if GetArchiveFormat(t.name) != TarGz {
+		return tar.NewReader(f), func() { f.Close() }, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return tar.NewReader(gz), func() { gz.Close(); f.Close() }, nil
+}
+
+// Read through the archive, calling fn on every entry until it returns true
+func (t *tarFS) scan(fn func(hdr *tar.Header, r io.Reader) bool) error {
+	tr, closeArchive, err := t.open()
+	if err != nil {
+		return err
+	}
+	defer closeArchive()
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fn(hdr, tr) {
+			return nil
+		}
+	}
+}
+
+func (t *tarFS) lookup(op, name string) (*tarEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	e, err := t.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.isDir() {
+		return &tarDir{entry: e}, nil
+	}
+
+	// The archive is read up to the entry, whose contents are then read as they are asked for
+	tr, closeArchive, err := t.open()
+	for index := 0; err == nil; index++ {
+		if _, err = tr.Next(); err == nil && index == e.index {
+			return &tarFile{entry: e, Reader: tr, close: closeArchive}, nil
+		}
+	}
+	if closeArchive != nil {
+		closeArchive()
+	}
+	if err == io.EOF {
+		err = fs.ErrNotExist
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+}
+
+func (t *tarFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := t.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e.info(), nil
+}
+
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := t.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries := make([]fs.DirEntry, len(e.children))
+	for ii, c := range e.children {
+		entries[ii] = tarDirEntry{c.info()}
+	}
+	return entries, nil
+}
+
+func (e *tarEntry) isDir() bool {
+	return e.header == nil || e.header.Typeflag == tar.TypeDir
+}
+
+func (e *tarEntry) info() fs.FileInfo {
+	if e.header != nil {
+		return e.header.FileInfo()
+	}
+	return impliedDirInfo{name: e.name, stored: e.storedName()}
+}
+
+// Returns the name that the items of a directory without a header are stored under, taken from the
+// name of an item below it, eg. ./dir for ./dir/file. Returns "" if no item below it has a header.
+func (e *tarEntry) storedName() string {
+	for _, c := range e.children {
+		name := c.storedName()
+		if c.header != nil {
+			name = strings.TrimSuffix(c.header.Name, "/")
+		}
+		if ii := strings.LastIndex(name, "/"); ii >= 0 {
+			return name[:ii]
+		}
+	}
+	return ""
+}
+
+// File info of a directory that has no header of its own in the archive
+type impliedDirInfo struct {
+	name   string
+	stored string // The name that its items are stored under
+}
+
+func (i impliedDirInfo) Name() string       { return i.name }
+func (i impliedDirInfo) Size() int64        { return 0 }
+func (i impliedDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (i impliedDirInfo) ModTime() time.Time { return time.Time{} }
+func (i impliedDirInfo) IsDir() bool        { return true }
+func (i impliedDirInfo) Sys() interface{}   { return nil }
+
+type tarDirEntry struct {
+	info fs.FileInfo
+}
+
+func (d tarDirEntry) Name() string               { return d.info.Name() }
+func (d tarDirEntry) IsDir() bool                { return d.info.IsDir() }
+func (d tarDirEntry) Type() fs.FileMode          { return d.info.Mode().Type() }
+func (d tarDirEntry) Info() (fs.FileInfo, error) { return d.info, nil }
+
+// tarFile reads the contents of an entry straight from the archive, which is closed with the file
+type tarFile struct {
+	entry *tarEntry
+	io.Reader
+	close func()
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry.info(), nil }
+func (f *tarFile) Close() error {
+	f.close()
+	return nil
+}
+
+type tarDir struct {
+	entry  *tarEntry
+	offset int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.entry.info(), nil }
+func (d *tarDir) Close() error               { return nil }
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: errors.New("is a directory")}
+}
+
+func (d *tarDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	remaining := d.entry.children[d.offset:]
+	if count > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && count < len(remaining) {
+		remaining = remaining[:count]
+	}
+	entries := make([]fs.DirEntry, len(remaining))
+	for ii, c := range remaining {
+		entries[ii] = tarDirEntry{c.info()}
+	}
+	d.offset += len(remaining)
+	return entries, nil
+}
+
+/*
+Extraction
+*/
+
+// Returns the shell command and arguments that extract the selected entry of a
+// directory inside an archive into the directory containing the archive.
+func (d *Directory) ExtractCommand() (string, []string, error) {
+	if d.Archive == "" {
+		return "", nil, errors.New("not inside an archive")
+	}
+	f, err := d.CurrentFile()
+	if err != nil {
+		return "", nil, err
+	}
+	entry := archiveName(f, path.Join(d.fsPath(), f.Name()))
+	dest := path.Dir(d.Archive)
+
+	switch GetArchiveFormat(d.Archive) {
+	case Zip:
+		args := []string{"-o", d.Archive, entry}
+		if f.IsDir() {
+			args = append(args, entry+"/*")
+		}
+		return "unzip", append(args, "-d", dest), nil
+	case Tar:
+		return "tar", []string{"-xf", d.Archive, "-C", dest, entry}, nil
+	case TarGz:
+		return "tar", []string{"-xzf", d.Archive, "-C", dest, entry}, nil
+	}
+	return "", nil, os.ErrInvalid
+}
+
+// Returns the name that an entry is stored under in its archive, which can differ from its path p in
+// the file system of the archive, eg. ./dir/file. Directories that have no entry of their own are named
+// as the items below them are stored.
+func archiveName(info os.FileInfo, p string) string {
+	if implied, ok := info.(impliedDirInfo); ok && implied.stored != "" {
+		return implied.stored
+	}
+	switch hdr := info.Sys().(type) {
+	case *tar.Header:
+		return strings.TrimSuffix(hdr.Name, "/")
+	case *zip.FileHeader:
+		return strings.TrimSuffix(hdr.Name, "/")
+	}
+	return p
+}
@@ -0,0 +1,259 @@
+package ctx
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var archiveFiles = []string{"top.txt", "inner/a.txt", "inner/deep/b.txt"}
+
+func makeZip() []byte {
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+	for _, name := range archiveFiles {
+		f, _ := w.Create(name)
+		f.Write([]byte(name))
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func makeTarGz() []byte {
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for _, name := range archiveFiles {
+		w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(name)), Typeflag: tar.TypeReg})
+		w.Write([]byte(name))
+	}
+	w.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestDescendArchive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/test.zip":    &fstest.MapFile{Data: makeZip()},
+		"dir/test.tar.gz": &fstest.MapFile{Data: makeTarGz()},
+	}
+
+	for _, name := range []string{"test.tar.gz", "test.zip"} {
+		dir, err := NewDirectoryFS(fsys, "/dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ii, f := range dir.Files {
+			if f.Name() == name {
+				dir.FileIdx = ii
+			}
+		}
+
+		root, err := dir.Descend()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "/dir/" + name + "!/"
+		if root.AbsPath != expected {
+			t.Error(fmt.Sprintf("Expected path %s, found %s", expected, root.AbsPath))
+		}
+		if len(root.Files) != 2 || root.Files[0].Name() != "inner" || !root.Files[0].IsDir() {
+			t.Error(fmt.Sprintf("Expected directory 'inner' at the root of %s", name))
+		}
+
+		inner, err := root.Descend()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = "/dir/" + name + "!/inner"
+		if inner.AbsPath != expected {
+			t.Error(fmt.Sprintf("Expected path %s, found %s", expected, inner.AbsPath))
+		}
+		if inner.Archive != "/dir/"+name {
+			t.Error(fmt.Sprintf("Expected archive /dir/%s, found %s", name, inner.Archive))
+		}
+		if len(inner.Files) != 2 {
+			t.Error(fmt.Sprintf("Expected 2 files, found %d", len(inner.Files)))
+		}
+
+		// Check that the contents of a file can be read
+		f, err := inner.FS.Open("inner/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents := make([]byte, 64)
+		n, _ := f.Read(contents)
+		f.Close()
+		if string(contents[:n]) != "inner/a.txt" {
+			t.Error(fmt.Sprintf("Unexpected contents %q", contents[:n]))
+		}
+	}
+}
+
+func TestExtractCommand(t *testing.T) {
+	fsys := fstest.MapFS{"dir/test.zip": &fstest.MapFile{Data: makeZip()}}
+	dir, err := NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := dir.ExtractCommand(); err == nil {
+		t.Error("Expected error extracting outside of an archive")
+	}
+	root, err := dir.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, args, err := root.ExtractCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "unzip -o /dir/test.zip inner inner/* -d /dir"
+	if full := cmd + " " + strings.Join(args, " "); full != expected {
+		t.Error(fmt.Sprintf("Expected command %q, found %q", expected, full))
+	}
+}
+
+func TestExtractOriginalName(t *testing.T) {
+	// Archives made with tar -cf archive.tar . store their members as ./name
+	buf := bytes.Buffer{}
+	w := tar.NewWriter(&buf)
+	w.WriteHeader(&tar.Header{Name: "./", Mode: 0755, Typeflag: tar.TypeDir})
+	w.WriteHeader(&tar.Header{Name: "./dir/", Mode: 0755, Typeflag: tar.TypeDir})
+	w.WriteHeader(&tar.Header{Name: "./dir/file", Mode: 0644, Typeflag: tar.TypeReg})
+	w.Close()
+	fsys := fstest.MapFS{"dir/test.tar": &fstest.MapFile{Data: buf.Bytes()}}
+	dir, err := NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := dir.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner, err := root.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		dir      *Directory
+		expected string
+	}{
+		{root, "tar -xf /dir/test.tar -C /dir ./dir"},
+		{inner, "tar -xf /dir/test.tar -C /dir ./dir/file"},
+	}
+	for _, c := range cases {
+		cmd, args, err := c.dir.ExtractCommand()
+		if full := cmd + " " + strings.Join(args, " "); err != nil || full != c.expected {
+			t.Error(fmt.Sprintf("Expected command %q, found %q, %v", c.expected, full, err))
+		}
+	}
+}
+
+func TestExtractImpliedDirectory(t *testing.T) {
+	// Archives can hold ./dir/sub/file without entries of their own for ./dir and ./dir/sub
+	buf := bytes.Buffer{}
+	w := tar.NewWriter(&buf)
+	w.WriteHeader(&tar.Header{Name: "./dir/sub/file", Mode: 0644, Typeflag: tar.TypeReg})
+	w.Close()
+	fsys := fstest.MapFS{"dir/test.tar": &fstest.MapFile{Data: buf.Bytes()}}
+	dir, err := NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := dir.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := root.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		dir      *Directory
+		expected string
+	}{
+		{root, "tar -xf /dir/test.tar -C /dir ./dir"},
+		{inner, "tar -xf /dir/test.tar -C /dir ./dir/sub"},
+	}
+	for _, c := range cases {
+		cmd, args, err := c.dir.ExtractCommand()
+		if full := cmd + " " + strings.Join(args, " "); err != nil || full != c.expected {
+			t.Error(fmt.Sprintf("Expected command %q, found %q, %v", c.expected, full, err))
+		}
+	}
+}
+
+func TestTarAppendedEntry(t *testing.T) {
+	// Entries appended with tar -rf replace the earlier entries with the same path
+	buf := bytes.Buffer{}
+	w := tar.NewWriter(&buf)
+	for _, contents := range []string{"old needle\n", "new\nneedle, a longer one\n"} {
+		w.WriteHeader(&tar.Header{Name: "./a.txt", Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+		w.Write([]byte(contents))
+	}
+	w.Close()
+	fsys := fstest.MapFS{"dir/test.tar": &fstest.MapFile{Data: buf.Bytes()}}
+	dir, err := NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := dir.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fs.Stat(archive.FS, "a.txt")
+	data, _ := fs.ReadFile(archive.FS, "a.txt")
+	if err != nil || string(data) != "new\nneedle, a longer one\n" || info.Size() != int64(len(data)) {
+		t.Error(fmt.Sprintf("Expected the last entry to be listed and read, found %q, %v", data, info))
+	}
+	expected := []string{"a.txt:2:needle, a longer one"}
+	if lines := grep(archive, "needle", GrepOptions{Workers: 1}); fmt.Sprintf("%q", lines) != fmt.Sprintf("%q", expected) {
+		t.Error(fmt.Sprintf("Expected only the last entry to be searched, found %q", lines))
+	}
+}
+
+func TestAscendClosesArchive(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "test.zip"), makeZip(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := NewDirectory(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := dir.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := archive.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.ReadFile(inner.FS, "top.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Leaving a directory inside of the archive keeps the archive open
+	inner.Ascend()
+	if _, err := fs.ReadFile(archive.FS, "top.txt"); err != nil {
+		t.Error(fmt.Sprintf("Expected the archive to stay open, found %v", err))
+	}
+	if parent, _ := archive.Ascend(); parent != dir || dir.Child != nil {
+		t.Error("Expected to leave the archive for the directory that contains it")
+	}
+	if _, err := fs.ReadFile(archive.FS, "top.txt"); err == nil {
+		t.Error("Expected the archive to be closed once it is left")
+	}
+}
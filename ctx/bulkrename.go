@@ -0,0 +1,114 @@
+package ctx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RenamePair is the renaming of the item at Src to Dst, both absolute paths
+type RenamePair struct {
+	Src string
+	Dst string
+}
+
+// PlanRenames checks that the renames can be made together and returns them in an order where no item
+// is renamed over another. Items that are renamed in a cycle, such as two items that swap names, cannot
+// be ordered so one item of the cycle is first renamed to a temporary name. Pairs that do not change the
+// name are left out. An item may only be renamed to a path that is free or that is renamed itself.
+func PlanRenames(renames []RenamePair) ([]RenamePair, error) {
+	var pending []RenamePair
+	sources := make(map[string]bool) // Items that are still to be renamed
+	targets := make(map[string]string)
+	for _, r := range renames {
+		r.Src, r.Dst = filepath.Clean(r.Src), filepath.Clean(r.Dst)
+		if r.Src == r.Dst {
+			continue
+		}
+		if err := checkName(filepath.Base(r.Dst)); err != nil {
+			return nil, fmt.Errorf("%s: %v", r.Src, err)
+		}
+		if sources[r.Src] {
+			return nil, fmt.Errorf("%s is renamed twice", r.Src)
+		}
+		if other, ok := targets[r.Dst]; ok {
+			return nil, fmt.Errorf("%s and %s are both renamed to %s", other, r.Src, r.Dst)
+		}
+		if err := checkNotInside("rename", r.Src, r.Dst); err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(filepath.Dir(r.Dst)); err != nil || !info.IsDir() {
+			return nil, &os.PathError{Op: "rename", Path: r.Dst, Err: fmt.Errorf("%s is not a directory", filepath.Dir(r.Dst))}
+		}
+		sources[r.Src] = true
+		targets[r.Dst] = r.Src
+		pending = append(pending, r)
+	}
+	for _, r := range pending {
+		if !sources[r.Dst] {
+			if err := checkNotExist("rename", r.Dst); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var steps []RenamePair
+	for len(pending) > 0 {
+		// Make every rename whose target is free, which frees the source for the next ones
+		var blocked []RenamePair
+		for _, r := range pending {
+			if sources[r.Dst] {
+				blocked = append(blocked, r)
+				continue
+			}
+			steps = append(steps, r)
+			delete(sources, r.Src)
+		}
+		if len(blocked) == len(pending) {
+			// Every rename waits for another one, so they are cycles. The first is broken by moving
+			// its item out of the way.
+			r := &blocked[0]
+			tmp, err := temporaryName(r.Src, targets)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, RenamePair{Src: r.Src, Dst: tmp})
+			delete(sources, r.Src)
+			r.Src = tmp
+		}
+		pending = blocked
+	}
+	return steps, nil
+}
+
+// Returns a free path next to path to move it to while it is in the way
+func temporaryName(path string, taken map[string]string) (string, error) {
+	for n := 1; n < 1000; n++ {
+		tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".itree-rename-%d-%s", n, filepath.Base(path)))
+		if _, ok := taken[tmp]; ok {
+			continue
+		}
+		if _, err := os.Lstat(tmp); os.IsNotExist(err) {
+			return tmp, nil
+		}
+	}
+	return "", fmt.Errorf("%s: no free temporary name", path)
+}
+
+// ApplyRenames makes the renames in order, as they are returned by PlanRenames. If one of them fails
+// the renames that were made are reverted, so that either all of the items are renamed or none are.
+func ApplyRenames(steps []RenamePair) error {
+	for ii, r := range steps {
+		err := checkNotExist("rename", r.Dst)
+		if err == nil {
+			err = os.Rename(r.Src, r.Dst)
+		}
+		if err != nil {
+			for jj := ii - 1; jj >= 0; jj-- {
+				os.Rename(steps[jj].Dst, steps[jj].Src)
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package ctx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanRenames(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "a", "b", "c", "d", "dir/")
+	p := func(name string) string { return filepath.Join(root, name) }
+
+	cases := []struct {
+		renames  string // Space separated src:dst
+		expected string // The steps, with tmp for the temporary names
+		err      string
+	}{
+		{"a:x", "a:x", ""},
+		{"a:a b:x", "b:x", ""},
+		// Chains are renamed from the end
+		{"a:b b:x", "b:x a:b", ""},
+		{"a:b b:a", "a:tmp b:a tmp:b", ""},
+		{"a:b b:c c:a d:y", "d:y a:tmp c:a b:c tmp:b", ""},
+		{"a:dir/a", "a:dir/a", ""},
+		{"a:b", "", "already exists"},
+		{"a:x b:x", "", "both renamed to"},
+		{"a:missing/a", "", "not a directory"},
+		{"dir:dir/sub", "", "cannot be inside"},
+	}
+	for _, c := range cases {
+		var renames []RenamePair
+		for _, pair := range strings.Fields(c.renames) {
+			names := strings.Split(pair, ":")
+			renames = append(renames, RenamePair{p(names[0]), p(names[1])})
+		}
+		steps, err := PlanRenames(renames)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Error(fmt.Sprintf("%s: Expected an error containing %q, found %v", c.renames, c.err, err))
+			}
+			continue
+		}
+		var found []string
+		for _, s := range steps {
+			name := func(path string) string {
+				if strings.HasPrefix(filepath.Base(path), ".itree-rename-") {
+					return "tmp"
+				}
+				rel, _ := filepath.Rel(root, path)
+				return rel
+			}
+			found = append(found, name(s.Src)+":"+name(s.Dst))
+		}
+		if err != nil || strings.Join(found, " ") != c.expected {
+			t.Error(fmt.Sprintf("%s: Expected %s, found %s, %v", c.renames, c.expected, strings.Join(found, " "), err))
+		}
+	}
+}
+
+func TestApplyRenames(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "a", "b", "c")
+	p := func(name string) string { return filepath.Join(root, name) }
+
+	steps, err := PlanRenames([]RenamePair{{p("a"), p("b")}, {p("b"), p("c")}, {p("c"), p("a")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyRenames(steps); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		// createFiles writes the name of each file into it
+		if data, _ := ioutil.ReadFile(p(name)); len(data) != 1 || name != map[string]string{"a": "b", "b": "c", "c": "a"}[string(data)] {
+			t.Error(fmt.Sprintf("Expected the names to be rotated, found %q in %s", data, name))
+		}
+	}
+
+	// A rename that fails reverts the ones before it
+	createFiles(t, root, "x")
+	err = ApplyRenames([]RenamePair{{p("a"), p("y")}, {p("b"), p("x")}})
+	if err == nil || !exists(p("a")) || exists(p("y")) {
+		t.Error(fmt.Sprintf("Expected the renames to be reverted, found %v", err))
+	}
+}
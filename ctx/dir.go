@@ -1,16 +1,16 @@
 package ctx
 
 import (
+	"archive/tar"
 	"errors"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
-
-	"github.com/lithammer/fuzzysearch/fuzzy"
 )
 
 func getPathComponents(path string) []string {
@@ -32,12 +32,30 @@ func getPathComponents(path string) []string {
 	return components
 }
 
+// LocalFS is the file system of the local disk, rooted at "/".
+var LocalFS fs.FS = os.DirFS("/")
+
+// Convert an absolute, slash separated path into a path that can be opened by an fs.FS
+func fsPath(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
 func CreateDirectoryChain(path string) (*Directory, error) {
+	return CreateDirectoryChainFS(LocalFS, path)
+}
+
+// Create the chain of directories from the root of the file system down to path.
+// path is absolute with respect to the root of fsys.
+func CreateDirectoryChainFS(fsys fs.FS, path string) (*Directory, error) {
 
 	var prevDir, nextDir *Directory
 	var err error
 	for _, subdir := range getPathComponents(path) {
-		nextDir, err = NewDirectory(subdir)
+		nextDir, err = NewDirectoryFS(fsys, subdir)
 
 		if err != nil {
 			return nil, err
@@ -45,12 +63,7 @@ func CreateDirectoryChain(path string) (*Directory, error) {
 		nextDir.Parent = prevDir
 		if prevDir != nil {
 			prevDir.Child = nextDir
-			for ii, f := range prevDir.Files {
-				if strings.HasSuffix(subdir, f.Name()) {
-					prevDir.FileIdx = ii
-					break
-				}
-			}
+			prevDir.SelectFile(filepath.Base(subdir))
 		}
 		prevDir = nextDir
 	}
@@ -64,40 +77,118 @@ Directory methods
 
 type Directory struct {
 	AbsPath       string
+	FS            fs.FS
+	Archive       string // Path of the archive this directory is inside of, if any
 	Files         []os.FileInfo
-	FilteredFiles map[int]os.FileInfo
+	FilteredFiles map[int]Match
 	FileIdx       int
 	ShowHidden    bool
+	SortMode      SortMode
+	SortDesc      bool
 	Parent        *Directory
 	Child         *Directory
+	matcher       Matcher // Filter for the files, nil if they are not filtered
 }
 
 type DirView = []*Directory
 
-// Methods for filtering files by directory, then file
-type OSFiles []os.FileInfo
+func NewDirectory(path string) (*Directory, error) {
+	return NewDirectoryFS(LocalFS, path)
+}
 
-func (f OSFiles) Len() int           { return len(f) }
-func (f OSFiles) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
-func (f OSFiles) Less(i, j int) bool { return f[i].IsDir() }
+// Create a directory whose contents are read from fsys.
+// path is absolute with respect to the root of fsys.
+func NewDirectoryFS(fsys fs.FS, path string) (*Directory, error) {
+	return newDirectory(fsys, "", path, nil)
+}
 
-func NewDirectory(path string) (*Directory, error) {
-	d := new(Directory)
-	if _, err := os.Stat(path); err != nil {
+// Create a directory, inheriting the sort order of parent if it is not nil
+func newDirectory(fsys fs.FS, archive, path string, parent *Directory) (*Directory, error) {
+	d := &Directory{AbsPath: path, FS: fsys, Archive: archive}
+	if parent != nil {
+		d.SortMode = parent.SortMode
+		d.SortDesc = parent.SortDesc
+	}
+	if _, err := fs.Stat(fsys, d.fsPath()); err != nil {
 		return nil, err
 	}
-	d.AbsPath = path
 	d.UpdateContents()
 	return d, nil
 }
 
+// Returns true if the directory is on the local disk
+func (d *Directory) IsLocal() bool {
+	return d.Archive == "" && d.FS == LocalFS
+}
+
+// Path of the directory within its file system
+func (d *Directory) fsPath() string {
+	if d.Archive != "" {
+		return fsPath(strings.TrimPrefix(d.AbsPath, d.Archive+ArchiveSep))
+	}
+	return fsPath(d.AbsPath)
+}
+
+// Returns the file info of the directory itself
+func (d *Directory) Stat() (os.FileInfo, error) {
+	return fs.Stat(d.FS, d.fsPath())
+}
+
+// Open a file in the directory for reading
+func (d *Directory) Open(name string) (fs.File, error) {
+	return d.FS.Open(path.Join(d.fsPath(), name))
+}
+
+// Read the contents of a subdirectory
+func (d *Directory) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(d.FS, path.Join(d.fsPath(), name))
+}
+
+// Returns the destination of a symbolic link in the directory
+func (d *Directory) Readlink(name string) (string, error) {
+	if d.IsLocal() {
+		return os.Readlink(path.Join(d.AbsPath, name))
+	}
+	// Links inside of tar archives are described by their header
+	if info, err := fs.Stat(d.FS, path.Join(d.fsPath(), name)); err == nil {
+		if hdr, ok := info.Sys().(*tar.Header); ok && hdr.Typeflag == tar.TypeSymlink {
+			return hdr.Linkname, nil
+		}
+	}
+	return "", &fs.PathError{Op: "readlink", Path: path.Join(d.AbsPath, name), Err: fs.ErrInvalid}
+}
+
+// Read the contents of the directory, in the same manner as ioutil.ReadDir
+func (d *Directory) readDir() ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(d.FS, d.fsPath())
+	if err != nil {
+		return nil, err
+	}
+	files := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			// The file was removed since reading the directory
+			continue
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
 func (d *Directory) UpdateContents() error {
 
-	files, err := ioutil.ReadDir(d.AbsPath)
+	files, err := d.readDir()
 	if err != nil {
 		return err
 	}
 
+	// Remember the selected file so that the selector stays on it
+	var selected string
+	if f, err := d.CurrentFile(); err == nil {
+		selected = f.Name()
+	}
+
 	var filtered []os.FileInfo
 	// Filter out hidden files
 	if !d.ShowHidden {
@@ -110,15 +201,45 @@ func (d *Directory) UpdateContents() error {
 	} else {
 		filtered = files[:]
 	}
-	// Sort by directory
-	sort.Sort(OSFiles(filtered))
+	d.Files = filtered
+	d.sortContents(selected)
+	return nil
+}
+
+// Sort the files and keep the selector on the selected file, if it still exists
+func (d *Directory) sortContents(selected string) {
+	sortFiles(d.Files, d.SortMode, d.SortDesc)
 
 	// Check that the index hasn't gone out of bounds
-	d.Files = filtered
-	if d.FileIdx > len(d.Files)-1 {
+	if !d.SelectFile(selected) && d.FileIdx > len(d.Files)-1 {
 		d.FileIdx = len(d.Files) - 1
 	}
-	return nil
+	if d.FileIdx < 0 {
+		d.FileIdx = 0
+	}
+	d.matchFilter()
+}
+
+// Change the order in which the files are listed
+func (d *Directory) SetSortMode(mode SortMode, descending bool) {
+	var selected string
+	if f, err := d.CurrentFile(); err == nil {
+		selected = f.Name()
+	}
+	d.SortMode = mode
+	d.SortDesc = descending
+	d.sortContents(selected)
+}
+
+// Move the selector to the file with the given name, returns false if it does not exist
+func (d *Directory) SelectFile(name string) bool {
+	for ii, f := range d.Files {
+		if f.Name() == name {
+			d.FileIdx = ii
+			return true
+		}
+	}
+	return false
 }
 
 func (d *Directory) CurrentFile() (os.FileInfo, error) {
@@ -130,29 +251,70 @@ func (d *Directory) CurrentFile() (os.FileInfo, error) {
 }
 
 func (d *Directory) Ascend() (*Directory, error) {
+	if d.isArchiveRoot() {
+		// Leaving an archive closes it, it is opened again when it is entered
+		d.Parent.Child = nil
+		d.closeArchive()
+	}
 	return d.Parent, nil
 }
 
+// Returns true if the directory is the top of an archive, which holds the file system of the archive
+func (d *Directory) isArchiveRoot() bool {
+	return d.Archive != "" && d.Parent != nil && d.Parent.Archive == ""
+}
+
+// Close the file that the archive of the directory is read from, if it is kept open.
+// Errors closing a file that was only read from are of no consequence.
+func (d *Directory) closeArchive() {
+	if c, ok := d.FS.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// CloseArchives closes the archives that are open in the directory or in the directories below it,
+// before the chain below the directory is thrown away
+func (d *Directory) CloseArchives() {
+	for c := d; c != nil; c = c.Child {
+		if c.isArchiveRoot() {
+			c.closeArchive()
+		}
+	}
+}
+
 func (d *Directory) Descend() (*Directory, error) {
 	if len(d.Files) == 0 {
 		return nil, nil
 	}
 	f := d.Files[d.FileIdx]
+	newpath := path.Join(d.AbsPath, f.Name())
+	var child *Directory
+	var err error
 	if f.IsDir() {
-		newpath := path.Join(d.AbsPath, f.Name())
-		child, err := NewDirectory(newpath)
-		if err != nil {
-			return nil, err
+		child, err = newDirectory(d.FS, d.Archive, newpath, d)
+	} else if IsArchive(f.Name()) {
+		if d.Archive != "" {
+			return nil, errors.New("cannot enter an archive inside of another archive")
 		}
-		child.Parent = d
-		if d.Child != nil {
-			d.Child.Parent = nil // Orphan the old child (...brutal)
+		// Present the contents of the archive as a virtual directory
+		var archiveFS fs.FS
+		archiveFS, err = OpenArchive(d.FS, path.Join(d.fsPath(), f.Name()))
+		if err == nil {
+			child, err = newDirectory(archiveFS, newpath, newpath+ArchiveSep+"/", d)
 		}
-		d.Child = child
-		return child, nil
 	} else {
 		return nil, errors.New("cannot enter non-directory")
 	}
+	if err != nil {
+		return nil, err
+	}
+	child.Parent = d
+	if d.Child != nil {
+		d.Child.CloseArchives()
+		d.Child.Parent = nil // Orphan the old child (...brutal)
+	}
+	d.Child = child
+	return child, nil
 }
 
 func (d *Directory) MoveSelector(dy int) {
@@ -199,28 +361,69 @@ func (d *Directory) SetShowHidden(v bool) {
 	d.UpdateContents()
 }
 
+// Fuzzy filter the contents of the directory and move the selector to the best match
 func (d *Directory) FilterContents(searchstring string) {
-	d.FilteredFiles = make(map[int]os.FileInfo)
+	if searchstring == "" {
+		d.FilterWith(nil)
+	} else {
+		d.FilterWith(fuzzyMatcher(searchstring))
+	}
+}
 
-	if len(searchstring) > 0 {
-		for ii, f := range d.Files {
+// Filter the contents of the directory with a matcher, nil to remove the filter,
+// and move the selector to the best match
+func (d *Directory) FilterWith(m Matcher) {
+	d.matcher = m
+	d.matchFilter()
+	d.SelectBestMatch()
+}
 
-			if fuzzy.Match(searchstring, f.Name()) {
-				//strings.Contains(f.Name(), searchstring) {
-				d.FilteredFiles[ii] = f
-			}
+// Returns true if the contents of the directory are filtered
+func (d *Directory) Filtered() bool {
+	return d.matcher != nil
+}
+
+// Move the selector to the file that best matches the filter. Ties go to the file listed first.
+func (d *Directory) SelectBestMatch() {
+	best := -1
+	for _, ii := range sortedMapKeys(d.FilteredFiles, false) {
+		if best < 0 || d.FilteredFiles[ii].Rank < d.FilteredFiles[best].Rank {
+			best = ii
 		}
 	}
+	if best >= 0 {
+		d.FileIdx = best
+	}
+}
 
-	if len(d.FilteredFiles) > 0 {
-		sortedIndices := sortedMapKeys(d.FilteredFiles, false)
-		d.FileIdx = sortedIndices[0]
+// Returns the indices of the files that are listed, in order. If onlyMatches is set and there is
+// a filter, only the files that match are listed, which can be none of them.
+func (d *Directory) ListedFiles(onlyMatches bool) []int {
+	if onlyMatches && d.Filtered() {
+		return sortedMapKeys(d.FilteredFiles, false)
+	}
+	indices := make([]int, len(d.Files))
+	for ii := range indices {
+		indices[ii] = ii
 	}
+	return indices
+}
 
+// Find the files that match the current filter
+func (d *Directory) matchFilter() {
+	d.FilteredFiles = make(map[int]Match)
+
+	if d.matcher != nil {
+		for ii, f := range d.Files {
+			if rank, positions, ok := d.matcher.Match(f.Name()); ok {
+				d.FilteredFiles[ii] = Match{FileInfo: f, Rank: rank, Positions: positions}
+			}
+		}
+	}
 }
 
 // Return a slice of the map keys sorted in ascending order
-func sortedMapKeys(files map[int]os.FileInfo, reverse bool) []int {
+func sortedMapKeys(files map[int]Match, reverse bool) []int {
 	filteredIndices := make([]int, 0, len(files))
 	for ii := range files {
 		filteredIndices = append(filteredIndices, ii)
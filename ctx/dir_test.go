@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"testing"
+	"testing/fstest"
 )
 
 var testDirRoot = "/tmp/itree"
@@ -103,6 +105,45 @@ func TestHiddenFiles(t *testing.T) {
 	}
 
 }
+func TestUpdateContentsKeepsSelection(t *testing.T) {
+	err := setUp()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tearDown()
+
+	curDir, err := getDirChain()
+	if err != nil {
+		t.Error(err)
+	}
+	a := curDir.Parent.Parent
+	a.FilterContents("f3")
+	a.SelectFile("f2")
+
+	// Add a file that is listed before the selected file
+	err = ioutil.WriteFile(testDirRoot+"/a/f0", nil, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.UpdateContents()
+	f, _ := a.CurrentFile()
+	if f.Name() != "f2" {
+		t.Error(fmt.Sprintf("Expected f2 to be selected, found %s", f.Name()))
+	}
+	// Check the filter was re-applied to the new contents
+	if m, ok := a.FilteredFiles[a.FileIdx+1]; !ok || m.Name() != "f3" {
+		t.Error("Expected the filter to be re-applied")
+	}
+
+	// Removing the selected file keeps the selector at the same position
+	os.Remove(testDirRoot + "/a/f2")
+	idx := a.FileIdx
+	a.UpdateContents()
+	if a.FileIdx != idx {
+		t.Error(fmt.Sprintf("Expected file index %d, found %d", idx, a.FileIdx))
+	}
+}
+
 func TestFilterContents(t *testing.T) {
 	err := setUp()
 	if err != nil {
@@ -201,3 +242,89 @@ func TestGetPathComponents(t *testing.T) {
 		t.Error(fmt.Sprintf("Expected %d components, found %d", expected, len(components)))
 	}
 }
+
+func TestDirectoryChainFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/f1":       &fstest.MapFile{},
+		"a/a1/f2":    &fstest.MapFile{},
+		"a/a1/a2/f3": &fstest.MapFile{},
+		"b/f4":       &fstest.MapFile{},
+	}
+
+	curDir, err := CreateDirectoryChainFS(fsys, "/a/a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nodes = []string{"/a/a1", "/a", "/"}
+	for _, p := range nodes {
+		if curDir.AbsPath != p {
+			t.Error(fmt.Sprintf("Expected directory %s, found %s", p, curDir.AbsPath))
+		}
+		if curDir.Parent == nil {
+			break
+		}
+		// The parent should have the child directory selected
+		f, _ := curDir.Parent.CurrentFile()
+		if expected := path.Base(curDir.AbsPath); f.Name() != expected {
+			t.Error(fmt.Sprintf("Expected %s to be selected, found %s", expected, f.Name()))
+		}
+		curDir = curDir.Parent
+	}
+
+	a1 := curDir.Child.Child
+	expected := 2
+	if len(a1.Files) != expected {
+		t.Error(fmt.Sprintf("Expected %d files, found %d", expected, len(a1.Files)))
+	}
+	a2, err := a1.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a2.AbsPath != "/a/a1/a2" || a2.FS == nil {
+		t.Error(fmt.Sprintf("Expected to descend into /a/a1/a2, found %s", a2.AbsPath))
+	}
+	if len(a2.Files) != 1 || a2.Files[0].Name() != "f3" {
+		t.Error("Expected descended directory to be read from the same file system")
+	}
+}
+
+func TestSubtree(t *testing.T) {
+	err := setUp()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tearDown()
+
+	dir, err := NewDirectory(testDirRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var flatten func(nodes []*Node) []string
+	flatten = func(nodes []*Node) []string {
+		var paths []string
+		for _, n := range nodes {
+			paths = append(paths, n.Path[len(testDirRoot):])
+			paths = append(paths, flatten(n.Children)...)
+		}
+		return paths
+	}
+
+	cases := []struct {
+		depth    int
+		match    func(string) bool
+		expected string
+	}{
+		{1, nil, "[/a /b]"},
+		{2, nil, "[/a /a/a1 /a/A1 /a/f1 /a/f2 /a/f3 /b /b/b1]"},
+		{0, func(name string) bool { return name == "f2" }, "[/a /a/a1 /a/a1/a2 /a/a1/a2/f2 /a/f2]"},
+		{2, func(name string) bool { return name == "f2" }, "[/a /a/f2]"},
+	}
+	for _, c := range cases {
+		found := fmt.Sprint(flatten(dir.Subtree(c.depth, c.match)))
+		if found != c.expected {
+			t.Error(fmt.Sprintf("Depth %d: expected %s, found %s", c.depth, c.expected, found))
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package ctx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// Returns an error if name is not the name of a single item, such as a name containing a /
+func checkName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("the name is empty")
+	case name == "." || name == "..":
+		return fmt.Errorf("%q is not a valid name", name)
+	case strings.ContainsRune(name, filepath.Separator):
+		return fmt.Errorf("%q contains a %c", name, filepath.Separator)
+	}
+	return nil
+}
+
+// Returns an error if an item exists at path
+func checkNotExist(op, path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return &os.PathError{Op: op, Path: path, Err: os.ErrExist}
+	}
+	return nil
+}
+
+// Returns an error if dst is src or inside of it, where a directory cannot be copied or moved to
+func checkNotInside(op, src, dst string) error {
+	rel, err := filepath.Rel(src, dst)
+	outside := rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	if err == nil && !outside {
+		return &os.PathError{Op: op, Path: dst, Err: errors.New("cannot be inside of " + src)}
+	}
+	return nil
+}
+
+// Rename an item in the directory it is in. Returns the new path of the item.
+func Rename(path, name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(filepath.Dir(path), name)
+	if err := checkNotExist("rename", dst); err != nil {
+		return "", err
+	}
+	return dst, os.Rename(path, dst)
+}
+
+// Create a directory and the parents of it that do not exist
+func Mkdir(path string) error {
+	if err := checkNotExist("mkdir", path); err != nil {
+		return err
+	}
+	return os.MkdirAll(path, 0777)
+}
+
+// Create an empty file, or set the modification time of the file to now if it exists
+func Touch(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// Returns the path that an item is copied or moved to when the user names dst. An item is put
+// inside of dst if dst is a directory, otherwise it takes the path dst.
+func Destination(src, dst string) string {
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		return filepath.Join(dst, filepath.Base(src))
+	}
+	return dst
+}
+
+// Copy an item to the destination the user named, see Destination. Returns the path of the copy.
+func Copy(src, dst string) (string, error) {
+	dst = Destination(src, dst)
+	return dst, CopyTo(src, dst)
+}
+
+// CopyTo copies an item, and everything in it if it is a directory, to the path dst. Existing items
+// are never replaced.
+func CopyTo(src, dst string) error {
+	if err := checkNotExist("copy", dst); err != nil {
+		return err
+	}
+	if err := checkNotInside("copy", src, dst); err != nil {
+		return err
+	}
+	return copyAll(src, dst)
+}
+
+func copyAll(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	mode := info.Mode()
+	switch {
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	case mode.IsDir():
+		// The directory is writable until its contents have been copied
+		if err := os.Mkdir(dst, mode.Perm()|0700); err != nil {
+			return err
+		}
+		entries, err := ioutil.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := copyAll(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+				return err
+			}
+		}
+		return os.Chmod(dst, mode.Perm())
+	case mode.IsRegular():
+		return copyFile(src, dst, mode.Perm())
+	}
+	return &os.PathError{Op: "copy", Path: src, Err: errors.New("not a regular file, directory or link")}
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Move an item to the destination the user named, see Destination. Returns the new path of the item.
+func Move(src, dst string) (string, error) {
+	dst = Destination(src, dst)
+	return dst, MoveTo(src, dst)
+}
+
+// MoveTo moves an item to the path dst. Items that cannot be renamed to dst, because it is on another
+// file system, are copied and then deleted. Existing items are never replaced.
+func MoveTo(src, dst string) error {
+	if err := checkNotExist("move", dst); err != nil {
+		return err
+	}
+	if err := checkNotInside("move", src, dst); err != nil {
+		return err
+	}
+	err := os.Rename(src, dst)
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) && linkErr.Err == syscall.EXDEV {
+		return moveAcross(src, dst)
+	}
+	return err
+}
+
+// Move an item to another file system by copying it and deleting it. A copy that fails is removed, so
+// that the item is only at src.
+func moveAcross(src, dst string) error {
+	if err := copyAll(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return &os.PathError{Op: "move", Path: src, Err: fmt.Errorf("copied to %s, but only part of it was deleted: %v", dst, err)}
+	}
+	return nil
+}
+
+// Complete a path that is being typed. Relative paths are relative to dir. Returns the path
+// extended by the longest prefix that the names of the matching items share, ending in a / if a
+// single directory matches, and the names of the matching items. Hidden items only match if the
+// name being typed starts with a dot.
+func CompletePath(dir, typed string) (string, []string) {
+	parent, prefix := filepath.Split(typed)
+	search := parent
+	if !filepath.IsAbs(search) {
+		search = filepath.Join(dir, search)
+	}
+	entries, err := ioutil.ReadDir(search)
+	if err != nil {
+		return typed, nil
+	}
+	var names []string
+	var isDir bool
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		names = append(names, name)
+		isDir = e.IsDir()
+		if e.Mode()&os.ModeSymlink != 0 {
+			info, err := os.Stat(filepath.Join(search, name))
+			isDir = err == nil && info.IsDir()
+		}
+	}
+	if len(names) == 0 {
+		return typed, nil
+	}
+	sort.Strings(names)
+	if len(names) == 1 {
+		completed := parent + names[0]
+		if isDir {
+			completed += string(filepath.Separator)
+		}
+		return completed, names
+	}
+	common := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, common) {
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	return parent + common, names
+}
@@ -0,0 +1,163 @@
+package ctx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Create the files below root, names ending in / are directories
+func createFiles(t *testing.T, root string, names ...string) {
+	for _, name := range names {
+		p := filepath.Join(root, name)
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(name), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func exists(p string) bool {
+	_, err := os.Lstat(p)
+	return err == nil
+}
+
+func TestRename(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "a", "b")
+
+	dst, err := Rename(filepath.Join(root, "a"), "c")
+	if err != nil || dst != filepath.Join(root, "c") || !exists(dst) || exists(filepath.Join(root, "a")) {
+		t.Error(fmt.Sprintf("Expected a to be renamed to c, found %s, %v", dst, err))
+	}
+	for _, name := range []string{"b", "", "..", "x/y"} {
+		if _, err := Rename(filepath.Join(root, "c"), name); err == nil {
+			t.Error(fmt.Sprintf("Expected an error renaming to %q", name))
+		}
+	}
+}
+
+func TestMkdirTouch(t *testing.T) {
+	root := t.TempDir()
+	if err := Mkdir(filepath.Join(root, "x/y")); err != nil || !exists(filepath.Join(root, "x/y")) {
+		t.Error(fmt.Sprintf("Expected x/y to be created, found %v", err))
+	}
+	if err := Mkdir(filepath.Join(root, "x")); err == nil {
+		t.Error("Expected an error creating a directory that exists")
+	}
+	p := filepath.Join(root, "x/file")
+	if err := Touch(p); err != nil || !exists(p) {
+		t.Error(fmt.Sprintf("Expected x/file to be created, found %v", err))
+	}
+	ioutil.WriteFile(p, []byte("keep"), 0644)
+	if err := Touch(p); err != nil {
+		t.Error(err)
+	}
+	if data, _ := ioutil.ReadFile(p); string(data) != "keep" {
+		t.Error(fmt.Sprintf("Expected touch to keep the contents, found %q", data))
+	}
+}
+
+func TestCopy(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "src/a", "src/sub/b", "dst/", "other")
+	os.Symlink("a", filepath.Join(root, "src/link"))
+
+	dst, err := Copy(filepath.Join(root, "src"), filepath.Join(root, "dst"))
+	if err != nil || dst != filepath.Join(root, "dst/src") {
+		t.Fatal(fmt.Sprintf("Expected src to be copied into dst, found %s, %v", dst, err))
+	}
+	for _, name := range []string{"src/a", "dst/src/a", "dst/src/sub/b"} {
+		if data, _ := ioutil.ReadFile(filepath.Join(root, name)); !strings.HasSuffix(name, string(data)) || len(data) == 0 {
+			t.Error(fmt.Sprintf("Expected %s to be copied, found %q", name, data))
+		}
+	}
+	if info, err := os.Stat(filepath.Join(root, "dst/src/a")); err != nil || info.Mode().Perm() != 0640 {
+		t.Error(fmt.Sprintf("Expected the permissions to be copied, found %v", info))
+	}
+	if target, err := os.Readlink(filepath.Join(root, "dst/src/link")); err != nil || target != "a" {
+		t.Error(fmt.Sprintf("Expected the link to be copied, found %q, %v", target, err))
+	}
+
+	// Copying to a new name
+	if dst, err := Copy(filepath.Join(root, "other"), filepath.Join(root, "dst/renamed")); err != nil || !exists(dst) {
+		t.Error(fmt.Sprintf("Expected other to be copied to dst/renamed, found %v", err))
+	}
+	if _, err := Copy(filepath.Join(root, "src"), filepath.Join(root, "dst")); err == nil {
+		t.Error("Expected an error replacing an existing item")
+	}
+	if _, err := Copy(filepath.Join(root, "src"), filepath.Join(root, "src/sub")); err == nil {
+		t.Error("Expected an error copying a directory into itself")
+	}
+}
+
+func TestMove(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "a", "dir/b", "dst/")
+
+	dst, err := Move(filepath.Join(root, "dir"), filepath.Join(root, "dst"))
+	if err != nil || !exists(filepath.Join(dst, "b")) || exists(filepath.Join(root, "dir")) {
+		t.Error(fmt.Sprintf("Expected dir to be moved into dst, found %s, %v", dst, err))
+	}
+	if _, err := Move(filepath.Join(root, "dst"), filepath.Join(root, "dst/dir")); err == nil {
+		t.Error("Expected an error moving a directory into itself")
+	}
+}
+
+func TestExactPaths(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "a", "b", "dir/")
+	p := func(name string) string { return filepath.Join(root, name) }
+
+	// An item is never put inside of a directory at the path it is copied or moved to
+	if err := CopyTo(p("a"), p("dir")); err == nil || exists(p("dir/a")) {
+		t.Error(fmt.Sprintf("Expected an error copying a to the existing dir, found %v", err))
+	}
+	if err := MoveTo(p("a"), p("dir")); err == nil || exists(p("dir/a")) || !exists(p("a")) {
+		t.Error(fmt.Sprintf("Expected an error moving a to the existing dir, found %v", err))
+	}
+	if err := CopyTo(p("a"), p("dir/c")); err != nil || !exists(p("dir/c")) {
+		t.Error(fmt.Sprintf("Expected a to be copied to dir/c, found %v", err))
+	}
+	if err := MoveTo(p("b"), p("dir/b")); err != nil || !exists(p("dir/b")) || exists(p("b")) {
+		t.Error(fmt.Sprintf("Expected b to be moved to dir/b, found %v", err))
+	}
+}
+
+func TestCompletePath(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "project/", "programs/", "public/index.html", ".profile", "readme")
+
+	cases := []struct {
+		typed     string
+		expected  string
+		completed []string
+	}{
+		{"pro", "pro", []string{"programs", "project"}},
+		{"proj", "project/", []string{"project"}},
+		{"pu", "public/", []string{"public"}},
+		{"public/i", "public/index.html", []string{"index.html"}},
+		{"r", "readme", []string{"readme"}},
+		{".p", ".profile", []string{".profile"}},
+		{"x", "x", nil},
+		{"missing/x", "missing/x", nil},
+		{root + "/pub", root + "/public/", []string{"public"}},
+	}
+	for _, c := range cases {
+		found, names := CompletePath(root, c.typed)
+		if found != c.expected || fmt.Sprint(names) != fmt.Sprint(c.completed) {
+			t.Error(fmt.Sprintf("Expected %q to complete to %q %v, found %q %v", c.typed, c.expected, c.completed, found, names))
+		}
+	}
+}
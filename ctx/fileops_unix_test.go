@@ -0,0 +1,24 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package ctx
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestMoveAcrossFails(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "src/a", "src/b/c")
+	// A named pipe cannot be copied, so the copy fails after a has been copied
+	if err := syscall.Mkfifo(filepath.Join(root, "src/b/pipe"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := moveAcross(filepath.Join(root, "src"), filepath.Join(root, "dst"))
+	if err == nil || exists(filepath.Join(root, "dst")) || !exists(filepath.Join(root, "src/b/c")) {
+		t.Error(fmt.Sprintf("Expected the partial copy to be removed and src to be kept, found %v", err))
+	}
+}
@@ -0,0 +1,154 @@
+package ctx
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Number of bytes at the start of a file that are checked for NUL bytes to decide if it is binary
+const binaryCheckBytes = 8000
+
+// GrepOptions control which files below a directory have their contents searched
+type GrepOptions struct {
+	SearchOptions
+	Workers     int   // Number of files that are searched at the same time
+	MaxFileSize int64 // Files larger than this are skipped, 0 for no limit
+}
+
+// GrepResult is a line of a file below a directory that contains the search text
+type GrepResult struct {
+	Path string // Path relative to the directory that was searched
+	Line int    // Line number, starting at 1
+	Text string // Contents of the line
+}
+
+// Grep searches the contents of the files below the directory for lines containing the text,
+// sending each line to results as it is found. Binary files and files larger than the maximum
+// size are skipped. The search stops early, returning the context's error, if it is cancelled.
+func (d *Directory) Grep(c context.Context, text string, opts GrepOptions, results chan<- GrepResult) error {
+	if t, ok := d.FS.(*tarFS); ok {
+		return d.grepTar(c, t, text, opts, results)
+	}
+	files := make(chan string)
+	var wg sync.WaitGroup
+	for ii := 0; ii < max(1, opts.Workers); ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range files {
+				// Files that cannot be read are skipped
+				_ = d.grepFile(c, rel, text, results)
+			}
+		}()
+	}
+
+	err := d.walk(c, opts.SearchOptions, func(rel string, entry fs.DirEntry) error {
+		if !opts.searched(entry) {
+			return nil
+		}
+		select {
+		case files <- rel:
+			return nil
+		case <-c.Done():
+			return c.Err()
+		}
+	})
+	close(files)
+	wg.Wait()
+	return err
+}
+
+// Returns true if the contents of the entry are searched
+func (opts GrepOptions) searched(entry fs.DirEntry) bool {
+	if !entry.Type().IsRegular() {
+		return false
+	}
+	if opts.MaxFileSize > 0 {
+		if info, err := entry.Info(); err != nil || info.Size() > opts.MaxFileSize {
+			return false
+		}
+	}
+	return true
+}
+
+// Search the files below the directory inside of a tar archive. Opening a file of a tar archive reads
+// the archive up to it, so the files are searched in a single pass through the archive instead.
+func (d *Directory) grepTar(c context.Context, t *tarFS, text string, opts GrepOptions, results chan<- GrepResult) error {
+	files := make(map[int]string) // Positions of the files in the archive to their paths relative to the directory
+	err := d.walk(c, opts.SearchOptions, func(rel string, entry fs.DirEntry) error {
+		if e, ok := t.entries[path.Join(d.fsPath(), rel)]; ok && opts.searched(entry) {
+			files[e.index] = rel
+		}
+		return nil
+	})
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	index := -1
+	err = t.scan(func(hdr *tar.Header, r io.Reader) bool {
+		index++
+		// Only the last entry of a path is searched, it is the one that is listed and opened
+		rel, ok := files[index]
+		if !ok {
+			return false
+		}
+		delete(files, index)
+		// Files that cannot be read are skipped
+		_ = grepReader(c, rel, r, text, results)
+		return c.Err() != nil || len(files) == 0
+	})
+	if c.Err() != nil {
+		return c.Err()
+	}
+	return err
+}
+
+// Search a file for lines containing the text
+func (d *Directory) grepFile(c context.Context, rel, text string, results chan<- GrepResult) error {
+	f, err := d.FS.Open(path.Join(d.fsPath(), rel))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return grepReader(c, rel, f, text, results)
+}
+
+// Search the contents of the file at rel for lines containing the text
+func grepReader(c context.Context, rel string, f io.Reader, text string, results chan<- GrepResult) error {
+	r := bufio.NewReaderSize(f, binaryCheckBytes)
+	head, err := r.Peek(binaryCheckBytes)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if !strings.Contains(scanner.Text(), text) {
+			continue
+		}
+		select {
+		case results <- GrepResult{Path: rel, Line: line, Text: scanner.Text()}:
+		case <-c.Done():
+			return c.Err()
+		}
+	}
+	return scanner.Err()
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
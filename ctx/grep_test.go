@@ -0,0 +1,106 @@
+package ctx
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var grepFS = fstest.MapFS{
+	"root/a.txt":        &fstest.MapFile{Data: []byte("first\nneedle here\nlast needle\n")},
+	"root/sub/b.txt":    &fstest.MapFile{Data: []byte("no match\n\tneedle\n")},
+	"root/binary":       &fstest.MapFile{Data: []byte("needle\x00\x01")},
+	"root/large.txt":    &fstest.MapFile{Data: []byte("needle" + strings.Repeat(".", 100))},
+	"root/.hidden/c.go": &fstest.MapFile{Data: []byte("needle")},
+}
+
+func grep(d *Directory, text string, opts GrepOptions) []string {
+	results := make(chan GrepResult)
+	go func() {
+		d.Grep(context.Background(), text, opts, results)
+		close(results)
+	}()
+	var lines []string
+	for r := range results {
+		lines = append(lines, fmt.Sprintf("%s:%d:%s", r.Path, r.Line, r.Text))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestGrep(t *testing.T) {
+	dir, err := NewDirectoryFS(grepFS, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := grep(dir, "needle", GrepOptions{Workers: 3, MaxFileSize: 50})
+	expected := []string{"a.txt:2:needle here", "a.txt:3:last needle", "sub/b.txt:2:\tneedle"}
+	if fmt.Sprintf("%q", lines) != fmt.Sprintf("%q", expected) {
+		t.Error(fmt.Sprintf("Expected %q, found %q", expected, lines))
+	}
+
+	// Without a size limit the large file is searched too
+	if lines = grep(dir, "needle", GrepOptions{}); len(lines) != 4 {
+		t.Error(fmt.Sprintf("Expected 4 lines, found %q", lines))
+	}
+}
+
+func TestGrepCancel(t *testing.T) {
+	dir, err := NewDirectoryFS(grepFS, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Nobody is receiving results, the search must stop rather than block
+	if err := dir.Grep(c, "needle", GrepOptions{Workers: 2}, make(chan GrepResult)); err != context.Canceled {
+		t.Error(fmt.Sprintf("Expected the search to be cancelled, found %v", err))
+	}
+}
+
+// A file system that counts the files that are opened
+type countingFS struct {
+	fstest.MapFS
+	opens map[string]int
+}
+
+func (c countingFS) Open(name string) (fs.File, error) {
+	c.opens[name]++
+	return c.MapFS.Open(name)
+}
+
+func TestGrepTar(t *testing.T) {
+	buf := bytes.Buffer{}
+	w := tar.NewWriter(&buf)
+	for _, name := range []string{"a.txt", "sub/b.txt", "binary", "large.txt"} {
+		data := grepFS["root/"+name].Data
+		w.WriteHeader(&tar.Header{Name: "./" + name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		w.Write(data)
+	}
+	w.Close()
+	fsys := countingFS{fstest.MapFS{"root/test.tar": &fstest.MapFile{Data: buf.Bytes()}}, make(map[string]int)}
+	dir, err := NewDirectoryFS(fsys, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := dir.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opens := fsys.opens["root/test.tar"]
+	lines := grep(archive, "needle", GrepOptions{Workers: 3, MaxFileSize: 50})
+	expected := []string{"a.txt:2:needle here", "a.txt:3:last needle", "sub/b.txt:2:\tneedle"}
+	if fmt.Sprintf("%q", lines) != fmt.Sprintf("%q", expected) {
+		t.Error(fmt.Sprintf("Expected %q, found %q", expected, lines))
+	}
+	if n := fsys.opens["root/test.tar"] - opens; n != 1 {
+		t.Error(fmt.Sprintf("Expected the archive to be read once, found %d times", n))
+	}
+}
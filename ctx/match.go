@@ -0,0 +1,157 @@
+package ctx
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lithammer/fuzzysearch/fuzzy"
+)
+
+// Match is a file in a directory that matched the filter
+type Match struct {
+	os.FileInfo
+	Rank      int   // Lower ranks are better matches
+	Positions []int // Indices of the runes in the file name that matched the filter
+}
+
+// Matcher decides which file names match a filter
+type Matcher interface {
+	// Match a name, returning the rank of the match and the indices of the runes in the name
+	// that matched. ok is false if the name does not match.
+	Match(name string) (rank int, positions []int, ok bool)
+}
+
+// MatchMode is the engine used to match file names
+type MatchMode int
+
+const (
+	MatchFuzzy MatchMode = iota
+	MatchSubstring
+	MatchGlob
+	MatchRegex
+	numMatchModes
+)
+
+// Prefixes of a query that select the match mode, in the order of the modes
+var matchPrefixes = []string{"f:", "s:", "g:", "r:"}
+
+func (m MatchMode) String() string {
+	return [...]string{"fuzzy", "substring", "glob", "regex"}[m]
+}
+
+// Next returns the match mode that follows this one, wrapping around after the last mode
+func (m MatchMode) Next() MatchMode {
+	return (m + 1) % numMatchModes
+}
+
+// ParseQuery splits the mode prefix (f:, s:, g: or r:) off a query. The mode is def if the
+// query has no prefix.
+func ParseQuery(query string, def MatchMode) (MatchMode, string) {
+	for mode, prefix := range matchPrefixes {
+		if strings.HasPrefix(query, prefix) {
+			return MatchMode(mode), query[len(prefix):]
+		}
+	}
+	return def, query
+}
+
+// NewMatcher creates a matcher for the pattern. An error is returned if the pattern is not a
+// valid glob or regular expression.
+func NewMatcher(mode MatchMode, pattern string) (Matcher, error) {
+	switch mode {
+	case MatchSubstring:
+		return substringMatcher(strings.Map(unicode.ToLower, pattern)), nil
+	case MatchGlob:
+		// Check the syntax of the pattern up front, filepath.Match only reports it when matching
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+		return globMatcher(pattern), nil
+	case MatchRegex:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return regexMatcher{re}, nil
+	default:
+		return fuzzyMatcher(pattern), nil
+	}
+}
+
+// Matches names that contain the characters of the pattern in order
+type fuzzyMatcher string
+
+func (m fuzzyMatcher) Match(name string) (int, []int, bool) {
+	return fuzzyMatch(string(m), name)
+}
+
+// Fuzzy match the query against a name, returning the rank of the match and the indices of the
+// runes in the name that matched. ok is false if the name does not match.
+func fuzzyMatch(query, name string) (rank int, positions []int, ok bool) {
+	rank = fuzzy.RankMatch(query, name)
+	if rank < 0 {
+		return 0, nil, false
+	}
+	// Each rune of the query matches the first occurrence of it after the previous match
+	positions = make([]int, 0, utf8.RuneCountInString(query))
+	queryRunes := []rune(query)
+	idx := 0
+	for _, r := range name {
+		if len(positions) < len(queryRunes) && r == queryRunes[len(positions)] {
+			positions = append(positions, idx)
+		}
+		idx++
+	}
+	return rank, positions, true
+}
+
+// Matches names that contain the pattern, ignoring case. The pattern is stored in lower case.
+type substringMatcher string
+
+func (m substringMatcher) Match(name string) (int, []int, bool) {
+	// Lower case each rune on its own so that indices into the name are kept
+	nameRunes := []rune(name)
+	for ii, r := range nameRunes {
+		nameRunes[ii] = unicode.ToLower(r)
+	}
+	idx := strings.Index(string(nameRunes), string(m))
+	if idx < 0 {
+		return 0, nil, false
+	}
+	start := utf8.RuneCountInString(string(nameRunes)[:idx])
+	return runeSpan(name, start, start+utf8.RuneCountInString(string(m)))
+}
+
+// Matches names against a shell pattern
+type globMatcher string
+
+func (m globMatcher) Match(name string) (int, []int, bool) {
+	ok, _ := filepath.Match(string(m), name)
+	return 0, nil, ok
+}
+
+// Matches names that contain a match of a regular expression
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m regexMatcher) Match(name string) (int, []int, bool) {
+	loc := m.re.FindStringIndex(name)
+	if loc == nil {
+		return 0, nil, false
+	}
+	return runeSpan(name, utf8.RuneCountInString(name[:loc[0]]), utf8.RuneCountInString(name[:loc[1]]))
+}
+
+// Returns a match of the runes from start up to end. Matches that cover more of the name rank better.
+func runeSpan(name string, start, end int) (int, []int, bool) {
+	positions := make([]int, 0, end-start)
+	for ii := start; ii < end; ii++ {
+		positions = append(positions, ii)
+	}
+	return utf8.RuneCountInString(name) - len(positions), positions, true
+}
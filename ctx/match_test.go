@@ -0,0 +1,158 @@
+package ctx
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	cases := []struct {
+		query, name string
+		positions   string
+		ok          bool
+	}{
+		{"mgo", "main.go", "[0 5 6]", true},
+		{"日語", "日本語", "[0 2]", true},
+		{"og", "main.go", "", false},
+	}
+	for _, c := range cases {
+		_, positions, ok := fuzzyMatch(c.query, c.name)
+		if ok != c.ok {
+			t.Error(fmt.Sprintf("Expected %q matching %q to be %v", c.query, c.name, c.ok))
+		} else if ok && fmt.Sprint(positions) != c.positions {
+			t.Error(fmt.Sprintf("Expected positions %s, found %v", c.positions, positions))
+		}
+	}
+}
+
+func TestFilterSelectsBestMatch(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/config.go":      &fstest.MapFile{},
+		"dir/cfg":            &fstest.MapFile{},
+		"dir/unrelated":      &fstest.MapFile{},
+		"dir/zz_long_cfg_go": &fstest.MapFile{},
+	}
+	dir, err := NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cfg is listed after config.go but is an exact match
+	dir.FilterContents("cfg")
+	if f, _ := dir.CurrentFile(); f.Name() != "cfg" {
+		t.Error(fmt.Sprintf("Expected the best match cfg to be selected, found %s", f.Name()))
+	}
+
+	var listed []string
+	for _, ii := range dir.ListedFiles(true) {
+		listed = append(listed, dir.Files[ii].Name())
+	}
+	if expected := "[cfg config.go zz_long_cfg_go]"; fmt.Sprint(listed) != expected {
+		t.Error(fmt.Sprintf("Expected %s, found %s", expected, listed))
+	}
+	if n := len(dir.ListedFiles(false)); n != 4 {
+		t.Error(fmt.Sprintf("Expected all 4 files to be listed, found %d", n))
+	}
+
+	// Without matches no file is listed, without a filter every file is
+	dir.FilterContents("nothing matches this")
+	if n := len(dir.ListedFiles(true)); n != 0 {
+		t.Error(fmt.Sprintf("Expected no files to be listed, found %d", n))
+	}
+	dir.FilterContents("")
+	if n := len(dir.ListedFiles(true)); n != 4 {
+		t.Error(fmt.Sprintf("Expected all 4 files to be listed, found %d", n))
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	cases := []struct {
+		mode      MatchMode
+		pattern   string
+		name      string
+		positions string
+		ok        bool
+	}{
+		{MatchFuzzy, "mgo", "main.go", "[0 5 6]", true},
+		{MatchSubstring, "MAIN", "the_Main.go", "[4 5 6 7]", true},
+		{MatchSubstring, "語", "日本語.txt", "[2]", true},
+		{MatchSubstring, "mgo", "main.go", "", false},
+		{MatchGlob, "*.go", "main.go", "[]", true},
+		{MatchGlob, "*.go", "main.gox", "", false},
+		{MatchRegex, `\.go$`, "main.go", "[4 5 6]", true},
+		{MatchRegex, `^a+`, "main.go", "", false},
+	}
+	for _, c := range cases {
+		m, err := NewMatcher(c.mode, c.pattern)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		_, positions, ok := m.Match(c.name)
+		if ok != c.ok {
+			t.Error(fmt.Sprintf("Expected %s %q matching %q to be %v", c.mode, c.pattern, c.name, c.ok))
+		} else if ok && fmt.Sprint(positions) != c.positions {
+			t.Error(fmt.Sprintf("Expected %s positions %s, found %v", c.mode, c.positions, positions))
+		}
+	}
+
+	// Longer matches of the same name rank better
+	m, _ := NewMatcher(MatchSubstring, "main")
+	short, _, _ := m.Match("main.go")
+	m, _ = NewMatcher(MatchSubstring, "main.g")
+	long, _, _ := m.Match("main.go")
+	if long >= short {
+		t.Error(fmt.Sprintf("Expected rank %d to be better than %d", long, short))
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	if _, err := NewMatcher(MatchRegex, "(unclosed"); err == nil {
+		t.Error("Expected an error for an invalid regular expression")
+	}
+	if _, err := NewMatcher(MatchGlob, "[unclosed"); err == nil {
+		t.Error("Expected an error for an invalid glob")
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	cases := []struct {
+		query   string
+		mode    MatchMode
+		pattern string
+	}{
+		{"main", MatchGlob, "main"},
+		{"f:main", MatchFuzzy, "main"},
+		{"s:main", MatchSubstring, "main"},
+		{"g:*.go", MatchGlob, "*.go"},
+		{"r:^m", MatchRegex, "^m"},
+	}
+	for _, c := range cases {
+		mode, pattern := ParseQuery(c.query, MatchGlob)
+		if mode != c.mode || pattern != c.pattern {
+			t.Error(fmt.Sprintf("Expected %q to parse as %s %q, found %s %q", c.query, c.mode, c.pattern, mode, pattern))
+		}
+	}
+}
+
+func TestFilterWith(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/a.go":  &fstest.MapFile{},
+		"dir/b.txt": &fstest.MapFile{},
+		"dir/c.go":  &fstest.MapFile{},
+	}
+	dir, err := NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := NewMatcher(MatchGlob, "*.go")
+	dir.FilterWith(m)
+	if len(dir.FilteredFiles) != 2 {
+		t.Error(fmt.Sprintf("Expected 2 matches, found %d", len(dir.FilteredFiles)))
+	}
+	dir.FilterWith(nil)
+	if len(dir.FilteredFiles) != 0 {
+		t.Error(fmt.Sprintf("Expected no matches, found %d", len(dir.FilteredFiles)))
+	}
+}
@@ -0,0 +1,130 @@
+package ctx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Owner is the user and group that own an item, -1 for either leaves it unchanged
+type Owner struct {
+	UID int
+	GID int
+}
+
+// Returns the ID of a user or group by its name, or the ID itself if it is a number
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	idStr, err := lookup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(idStr)
+}
+
+// ParseOwner parses the owner of items written as chown takes it: USER, USER:GROUP or :GROUP to only
+// change the group. Users and groups are given by name or by ID.
+func ParseOwner(spec string) (Owner, error) {
+	owner := Owner{UID: -1, GID: -1}
+	name, group := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		name, group = spec[:i], spec[i+1:]
+	}
+	if name == "" && group == "" {
+		return owner, errors.New("the owner is empty")
+	}
+	var err error
+	if name != "" {
+		owner.UID, err = lookupID(name, func(n string) (string, error) {
+			u, err := user.Lookup(n)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return owner, err
+		}
+	}
+	if group != "" {
+		owner.GID, err = lookupID(group, func(n string) (string, error) {
+			g, err := user.LookupGroup(n)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return owner, err
+		}
+	}
+	return owner, nil
+}
+
+// OwnerUpdate is the change of the owner of one item
+type OwnerUpdate struct {
+	Path string
+	Old  Owner
+	New  Owner
+}
+
+// PlanChown returns the items whose owner changes. Links are changed themselves rather than what
+// they point to, as chown -h does.
+func PlanChown(paths []string, owner Owner, recursive bool) ([]OwnerUpdate, error) {
+	var updates []OwnerUpdate
+	add := func(p string, info os.FileInfo) error {
+		uid, gid, ok := ownerOf(info)
+		if !ok {
+			return fmt.Errorf("%s: the owner is not known on this system", p)
+		}
+		next := Owner{UID: uid, GID: gid}
+		if owner.UID >= 0 {
+			next.UID = owner.UID
+		}
+		if owner.GID >= 0 {
+			next.GID = owner.GID
+		}
+		if next.UID != uid || next.GID != gid {
+			updates = append(updates, OwnerUpdate{Path: p, Old: Owner{UID: uid, GID: gid}, New: next})
+		}
+		return nil
+	}
+	for _, p := range paths {
+		info, err := os.Lstat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !recursive || !info.IsDir() {
+			if err := add(p, info); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := filepath.Walk(p, func(sub string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return add(sub, info)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return updates, nil
+}
+
+// ApplyChown changes the owners of the items, stopping at the first error. Returns the updates
+// that were made.
+func ApplyChown(updates []OwnerUpdate) ([]OwnerUpdate, error) {
+	for ii, u := range updates {
+		if err := os.Lchown(u.Path, u.New.UID, u.New.GID); err != nil {
+			return updates[:ii], err
+		}
+	}
+	return updates, nil
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package ctx
+
+import "os"
+
+// Items do not have an owner with a user and group ID on this platform
+func ownerOf(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,18 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package ctx
+
+import (
+	"os"
+	"syscall"
+)
+
+// Returns the user and group IDs of the owner of an item
+func ownerOf(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
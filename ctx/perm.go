@@ -0,0 +1,303 @@
+package ctx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The permission bits as chmod writes them in octal
+const (
+	unixSetuid = 04000
+	unixSetgid = 02000
+	unixSticky = 01000
+)
+
+// The umask of the process, which masks the clauses of a symbolic mode that leave out who they change
+var umask = readUmask()
+
+// PermBits are the bits of a mode that chmod changes: the permissions, setuid, setgid and sticky
+const PermBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// UnixMode returns the permission bits of a mode as chmod writes them, such as 04755
+func UnixMode(m os.FileMode) uint32 {
+	bits := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		bits |= unixSetuid
+	}
+	if m&os.ModeSetgid != 0 {
+		bits |= unixSetgid
+	}
+	if m&os.ModeSticky != 0 {
+		bits |= unixSticky
+	}
+	return bits
+}
+
+// FromUnixMode returns the mode of permission bits written as chmod writes them
+func FromUnixMode(bits uint32) os.FileMode {
+	m := os.FileMode(bits & 0777)
+	if bits&unixSetuid != 0 {
+		m |= os.ModeSetuid
+	}
+	if bits&unixSetgid != 0 {
+		m |= os.ModeSetgid
+	}
+	if bits&unixSticky != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// FormatMode writes the permission bits like ls does, such as rwsr-xr-x
+func FormatMode(m os.FileMode) string {
+	bits := UnixMode(m)
+	out := []byte("rwxrwxrwx")
+	for ii := range out {
+		if bits&(1<<uint(8-ii)) == 0 {
+			out[ii] = '-'
+		}
+	}
+	special := []struct {
+		bit   uint32
+		index int
+		set   byte // Shown when execute is also set, the upper case letter is shown when it is not
+	}{
+		{unixSetuid, 2, 's'}, {unixSetgid, 5, 's'}, {unixSticky, 8, 't'},
+	}
+	for _, s := range special {
+		if bits&s.bit == 0 {
+			continue
+		}
+		if out[s.index] == 'x' {
+			out[s.index] = s.set
+		} else {
+			out[s.index] = s.set - 'a' + 'A'
+		}
+	}
+	return string(out)
+}
+
+// ParseMode returns the permissions of an item after applying a mode to them. The mode is either octal,
+// such as 755, or symbolic like chmod takes it: a comma separated list of clauses such as u+x,go-w or
+// a=rX. A clause changes the permissions of the user (u), group (g), others (o) or all of them (a) by
+// adding (+), removing (-) or setting (=) read (r), write (w), execute (x), execute if the item is a
+// directory or anyone may execute it (X), setuid and setgid (s) and sticky (t), or the permissions that
+// the user, group or others have (u, g or o). As with chmod, a clause that leaves out who it changes
+// changes all of them except for the bits in the umask, and = keeps the setuid and setgid of a
+// directory unless s is given.
+func ParseMode(expr string, mode os.FileMode, isDir bool) (os.FileMode, error) {
+	if expr == "" {
+		return mode, errors.New("the mode is empty")
+	}
+	if strings.Trim(expr, "01234567") == "" {
+		bits, err := strconv.ParseUint(expr, 8, 32)
+		if err != nil || bits > 07777 {
+			return mode, fmt.Errorf("%q is not an octal mode", expr)
+		}
+		return FromUnixMode(uint32(bits)), nil
+	}
+
+	bits := UnixMode(mode)
+	for _, clause := range strings.Split(expr, ",") {
+		var who uint32
+		ii := 0
+	who:
+		for ; ii < len(clause); ii++ {
+			switch clause[ii] {
+			case 'u':
+				who |= unixSetuid | 0700
+			case 'g':
+				who |= unixSetgid | 0070
+			case 'o':
+				who |= unixSticky | 0007
+			case 'a':
+				who |= 07777
+			default:
+				break who
+			}
+		}
+		masked := who == 0
+		if masked {
+			who = 07777
+		}
+		if ii == len(clause) {
+			return mode, fmt.Errorf("%q is missing +, - or =", clause)
+		}
+		for ii < len(clause) {
+			op := clause[ii]
+			if op != '+' && op != '-' && op != '=' {
+				return mode, fmt.Errorf("%q: expected +, - or = instead of %q", clause, op)
+			}
+			ii++
+			var perm uint32
+			for ; ii < len(clause) && !strings.ContainsRune("+-=", rune(clause[ii])); ii++ {
+				switch c := clause[ii]; c {
+				case 'r':
+					perm |= 0444
+				case 'w':
+					perm |= 0222
+				case 'x':
+					perm |= 0111
+				case 'X':
+					if isDir || bits&0111 != 0 {
+						perm |= 0111
+					}
+				case 's':
+					perm |= unixSetuid | unixSetgid
+				case 't':
+					perm |= unixSticky
+				case 'u', 'g', 'o':
+					// Copy the permissions of a class to the others
+					shift := map[byte]uint{'u': 6, 'g': 3, 'o': 0}[c]
+					perm |= ((bits >> shift) & 7) * 0111
+				default:
+					return mode, fmt.Errorf("%q: unknown permission %q", clause, c)
+				}
+			}
+			perm &= who
+			if masked {
+				perm &^= umask
+			}
+			switch op {
+			case '+':
+				bits |= perm
+			case '-':
+				bits &^= perm
+			case '=':
+				cleared := who
+				if isDir {
+					cleared &^= unixSetuid | unixSetgid
+				}
+				bits = bits&^cleared | perm
+			}
+		}
+	}
+	return FromUnixMode(bits), nil
+}
+
+// ModeChange is a change of permissions that may treat directories and files differently
+type ModeChange struct {
+	Dirs      string // Mode applied to directories, "" to leave them unchanged
+	Files     string // Mode applied to everything that is not a directory, "" to leave them unchanged
+	Recursive bool   // Change the items inside of directories too
+}
+
+// ParseModeChange parses a change of permissions written as [-R] MODE, or as [-R] d:MODE f:MODE to
+// change directories and files differently, where either may be left out. -R changes the items inside
+// of directories too.
+func ParseModeChange(input string) (ModeChange, error) {
+	var c ModeChange
+	fields := strings.Fields(input)
+	if len(fields) > 0 && fields[0] == "-R" {
+		c.Recursive = true
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return c, errors.New("the mode is empty")
+	}
+	for _, field := range fields {
+		switch {
+		case strings.HasPrefix(field, "d:"):
+			c.Dirs = field[2:]
+		case strings.HasPrefix(field, "f:"):
+			c.Files = field[2:]
+		case len(fields) == 1:
+			c.Dirs, c.Files = field, field
+		default:
+			return c, fmt.Errorf("%q: expected d:MODE or f:MODE when there is more than one mode", field)
+		}
+	}
+	// The modes are checked now so that the error is shown before anything changes
+	for _, expr := range []string{c.Dirs, c.Files} {
+		if _, err := ParseMode(expr, 0, true); expr != "" && err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// Apply returns the permissions of an item after the change
+func (c ModeChange) Apply(mode os.FileMode, isDir bool) (os.FileMode, error) {
+	expr := c.Files
+	if isDir {
+		expr = c.Dirs
+	}
+	if expr == "" {
+		return mode & PermBits, nil
+	}
+	return ParseMode(expr, mode&PermBits, isDir)
+}
+
+// ModeUpdate is the change of the permissions of one item
+type ModeUpdate struct {
+	Path  string
+	IsDir bool
+	Old   os.FileMode
+	New   os.FileMode
+}
+
+// PlanChmod returns the items whose permissions change, and how. Links that are given are followed,
+// links inside of directories are left alone as chmod -R does.
+func PlanChmod(paths []string, c ModeChange) ([]ModeUpdate, error) {
+	var updates []ModeUpdate
+	add := func(p string, info os.FileInfo) error {
+		mode, err := c.Apply(info.Mode(), info.IsDir())
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		if old := info.Mode() & PermBits; mode != old {
+			updates = append(updates, ModeUpdate{Path: p, IsDir: info.IsDir(), Old: old, New: mode})
+		}
+		return nil
+	}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := add(p, info); err != nil {
+			return nil, err
+		}
+		if !c.Recursive || !info.IsDir() {
+			continue
+		}
+		err = filepath.Walk(p, func(sub string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if sub == p || info.Mode()&os.ModeSymlink != 0 {
+				return nil
+			}
+			return add(sub, info)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return updates, nil
+}
+
+// ApplyChmod changes the permissions of the items, stopping at the first error. Returns the updates
+// that were made, in the order they were made. Directories that lose read or execute permission are
+// changed last, after the items inside of them.
+func ApplyChmod(updates []ModeUpdate) ([]ModeUpdate, error) {
+	var ordered, last []ModeUpdate
+	for _, u := range updates {
+		if u.IsDir && UnixMode(u.Old)&^UnixMode(u.New)&0555 != 0 {
+			last = append([]ModeUpdate{u}, last...)
+		} else {
+			ordered = append(ordered, u)
+		}
+	}
+	ordered = append(ordered, last...)
+	for ii, u := range ordered {
+		if err := os.Chmod(u.Path, u.New); err != nil {
+			return ordered[:ii], err
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,181 @@
+package ctx
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	defer func(mask uint32) { umask = mask }(umask)
+	umask = 0
+	cases := []struct {
+		expr     string
+		mode     uint32
+		isDir    bool
+		expected uint32
+		err      bool
+	}{
+		{"755", 0644, false, 0755, false},
+		{"4755", 0644, false, 04755, false},
+		{"u+x", 0644, false, 0744, false},
+		{"go-w", 0666, false, 0644, false},
+		{"u+x,go-w", 0666, false, 0744, false},
+		{"a=r", 0755, false, 0444, false},
+		{"=rw", 0755, false, 0666, false},
+		{"+x", 0644, false, 0755, false},
+		{"a+X", 0644, false, 0644, false},
+		{"a+X", 0644, true, 0755, false},
+		{"a+X", 0744, false, 0755, false},
+		{"u+s,o+t", 0755, true, 05755, false},
+		{"g+s", 0755, true, 02755, false},
+		{"g=u", 0740, false, 0770, false},
+		{"u+x-w", 0644, false, 0544, false},
+		{"o=", 0777, false, 0770, false},
+		{"a=rx", 06755, false, 0555, false},
+		{"a=rx", 06755, true, 06555, false},
+		{"g=", 02755, true, 02705, false},
+		{"g=rxs", 0755, true, 02755, false},
+		{"g-s", 02755, true, 0755, false},
+		{"u", 0644, false, 0, true},
+		{"u+z", 0644, false, 0, true},
+		{"x+r", 0644, false, 0, true},
+		{"17777", 0644, false, 0, true},
+		{"", 0644, false, 0, true},
+	}
+	for _, c := range cases {
+		mode, err := ParseMode(c.expr, FromUnixMode(c.mode), c.isDir)
+		if c.err {
+			if err == nil {
+				t.Error(fmt.Sprintf("%q: Expected an error, found %04o", c.expr, UnixMode(mode)))
+			}
+			continue
+		}
+		if err != nil || UnixMode(mode) != c.expected {
+			t.Error(fmt.Sprintf("%q on %04o: Expected %04o, found %04o, %v", c.expr, c.mode, c.expected, UnixMode(mode), err))
+		}
+	}
+}
+
+func TestParseModeUmask(t *testing.T) {
+	defer func(mask uint32) { umask = mask }(umask)
+	umask = 022
+	cases := []struct {
+		expr     string
+		mode     uint32
+		expected uint32
+	}{
+		{"+w", 0644, 0644},
+		{"+x", 0644, 0755},
+		{"-w", 0777, 0577},
+		{"=r", 04777, 0444},
+		{"=rw", 0755, 0644},
+		{"a+w", 0644, 0666},
+		{"go+w", 0644, 0666},
+	}
+	for _, c := range cases {
+		mode, err := ParseMode(c.expr, FromUnixMode(c.mode), false)
+		if err != nil || UnixMode(mode) != c.expected {
+			t.Error(fmt.Sprintf("%q on %04o with umask 022: Expected %04o, found %04o, %v", c.expr, c.mode, c.expected, UnixMode(mode), err))
+		}
+	}
+}
+
+func TestFormatMode(t *testing.T) {
+	cases := map[uint32]string{
+		0644:  "rw-r--r--",
+		0755:  "rwxr-xr-x",
+		04755: "rwsr-xr-x",
+		02745: "rwxr-Sr-x",
+		01777: "rwxrwxrwt",
+		01776: "rwxrwxrwT",
+	}
+	for bits, expected := range cases {
+		if found := FormatMode(FromUnixMode(bits)); found != expected {
+			t.Error(fmt.Sprintf("%04o: Expected %s, found %s", bits, expected, found))
+		}
+	}
+}
+
+func TestParseModeChange(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected ModeChange
+		err      bool
+	}{
+		{"644", ModeChange{Dirs: "644", Files: "644"}, false},
+		{"-R u+w", ModeChange{Dirs: "u+w", Files: "u+w", Recursive: true}, false},
+		{"-R d:755 f:644", ModeChange{Dirs: "755", Files: "644", Recursive: true}, false},
+		{"f:a-x", ModeChange{Files: "a-x"}, false},
+		{"-R", ModeChange{}, true},
+		{"644 755", ModeChange{}, true},
+		{"d:u+q", ModeChange{}, true},
+	}
+	for _, c := range cases {
+		change, err := ParseModeChange(c.input)
+		if c.err != (err != nil) || (!c.err && change != c.expected) {
+			t.Error(fmt.Sprintf("%q: Expected %+v, found %+v, %v", c.input, c.expected, change, err))
+		}
+	}
+}
+
+func TestPlanChmod(t *testing.T) {
+	root := t.TempDir()
+	createFiles(t, root, "dir/a", "dir/sub/b")
+	os.Chmod(filepath.Join(root, "dir/sub"), 0700)
+	os.Symlink("a", filepath.Join(root, "dir/link"))
+
+	change, _ := ParseModeChange("-R d:755 f:600")
+	updates, err := PlanChmod([]string{filepath.Join(root, "dir")}, change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, u := range updates {
+		rel, _ := filepath.Rel(root, u.Path)
+		found = append(found, fmt.Sprintf("%s %04o", rel, UnixMode(u.New)))
+	}
+	// dir is already 755, and the link is left alone
+	if fmt.Sprint(found) != "[dir/a 0600 dir/sub 0755 dir/sub/b 0600]" {
+		t.Error(fmt.Sprintf("Expected the files and the directories to change differently, found %v", found))
+	}
+
+	// Directories that lose permission are changed after the items in them
+	change, _ = ParseModeChange("-R a-x")
+	updates, _ = PlanChmod([]string{filepath.Join(root, "dir")}, change)
+	done, err := ApplyChmod(updates)
+	if err != nil || len(done) != 2 || done[len(done)-1].Path != filepath.Join(root, "dir") {
+		t.Error(fmt.Sprintf("Expected dir to be changed last, found %+v, %v", done, err))
+	}
+	os.Chmod(filepath.Join(root, "dir"), 0755)
+	os.Chmod(filepath.Join(root, "dir/sub"), 0755)
+}
+
+func TestParseOwner(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	uid, _ := strconv.Atoi(current.Uid)
+	gid, _ := strconv.Atoi(current.Gid)
+	cases := []struct {
+		spec     string
+		expected Owner
+		err      bool
+	}{
+		{current.Username, Owner{uid, -1}, false},
+		{current.Uid + ":" + current.Gid, Owner{uid, gid}, false},
+		{":" + current.Gid, Owner{-1, gid}, false},
+		{"no-such-user-itree", Owner{}, true},
+		{":", Owner{}, true},
+	}
+	for _, c := range cases {
+		owner, err := ParseOwner(c.spec)
+		if c.err != (err != nil) || (!c.err && owner != c.expected) {
+			t.Error(fmt.Sprintf("%q: Expected %+v, found %+v, %v", c.spec, c.expected, owner, err))
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package ctx
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+
+	"github.com/lithammer/fuzzysearch/fuzzy"
+)
+
+// Names of directories that are never searched
+var IgnoredDirs = []string{".git", ".hg", ".svn", "node_modules"}
+
+// SearchOptions control which files below a directory are searched
+type SearchOptions struct {
+	MaxDepth   int  // Number of directory levels to search, 0 for no limit
+	ShowHidden bool // Search hidden files and directories
+}
+
+// SearchResult is a file below a directory whose name matched the search
+type SearchResult struct {
+	Path  string // Path relative to the directory that was searched
+	IsDir bool
+	Rank  int // Lower ranks are better matches
+}
+
+// Walk the files below the directory, calling fn with the path of each file relative to the directory.
+// Hidden files and ignored directories are skipped. Walking stops when the context is cancelled.
+func (d *Directory) walk(c context.Context, opts SearchOptions, fn func(rel string, entry fs.DirEntry) error) error {
+	root := d.fsPath()
+	err := fs.WalkDir(d.FS, root, func(p string, entry fs.DirEntry, err error) error {
+		if c.Err() != nil {
+			return c.Err()
+		}
+		if p == root {
+			return err
+		}
+		if err != nil {
+			// Skip directories that cannot be read
+			return nil
+		}
+		rel := strings.TrimPrefix(p, root+"/")
+		if root == "." {
+			rel = p
+		}
+		name := entry.Name()
+		if !opts.ShowHidden && strings.HasPrefix(name, ".") {
+			return skip(entry)
+		}
+		if entry.IsDir() {
+			for _, ignored := range IgnoredDirs {
+				if name == ignored {
+					return fs.SkipDir
+				}
+			}
+		}
+		if err := fn(rel, entry); err != nil {
+			return err
+		}
+		if entry.IsDir() && opts.MaxDepth > 0 && strings.Count(rel, "/")+1 >= opts.MaxDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return err
+}
+
+// Skip a file, and all of its contents if it is a directory
+func skip(entry fs.DirEntry) error {
+	if entry.IsDir() {
+		return fs.SkipDir
+	}
+	return nil
+}
+
+// Search the files below the directory for names that fuzzy match the query, sending each match
+// to results as it is found. The search stops early, returning the context's error, if it is cancelled.
+func (d *Directory) Search(c context.Context, query string, opts SearchOptions, results chan<- SearchResult) error {
+	return d.walk(c, opts, func(rel string, entry fs.DirEntry) error {
+		rank := fuzzy.RankMatch(query, entry.Name())
+		if rank < 0 {
+			return nil
+		}
+		select {
+		case results <- SearchResult{Path: rel, IsDir: entry.IsDir(), Rank: rank}:
+			return nil
+		case <-c.Done():
+			return c.Err()
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package ctx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+var searchFS = fstest.MapFS{
+	"root/main.go":             &fstest.MapFile{},
+	"root/pkg/main_test.go":    &fstest.MapFile{},
+	"root/pkg/deep/er/main.go": &fstest.MapFile{},
+	"root/.hidden/main.go":     &fstest.MapFile{},
+	"root/.git/main.go":        &fstest.MapFile{},
+	"root/readme.md":           &fstest.MapFile{},
+}
+
+func search(d *Directory, query string, opts SearchOptions) []string {
+	results := make(chan SearchResult)
+	go func() {
+		d.Search(context.Background(), query, opts, results)
+		close(results)
+	}()
+	var paths []string
+	for r := range results {
+		paths = append(paths, r.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestSearch(t *testing.T) {
+	dir, err := NewDirectoryFS(searchFS, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		query    string
+		opts     SearchOptions
+		expected string
+	}{
+		{"main", SearchOptions{}, "[main.go pkg/deep/er/main.go pkg/main_test.go]"},
+		{"main", SearchOptions{MaxDepth: 2}, "[main.go pkg/main_test.go]"},
+		{"main", SearchOptions{ShowHidden: true}, "[.hidden/main.go main.go pkg/deep/er/main.go pkg/main_test.go]"},
+		{"er", SearchOptions{}, "[pkg/deep/er]"},
+	}
+	for _, c := range cases {
+		if found := fmt.Sprint(search(dir, c.query, c.opts)); found != c.expected {
+			t.Error(fmt.Sprintf("Searching for %q: expected %s, found %s", c.query, c.expected, found))
+		}
+	}
+}
+
+func TestSearchCancel(t *testing.T) {
+	dir, err := NewDirectoryFS(searchFS, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Nobody is receiving results, the search must stop rather than block
+	if err := dir.Search(c, "main", SearchOptions{}, make(chan SearchResult)); err != context.Canceled {
+		t.Error(fmt.Sprintf("Expected the search to be cancelled, found %v", err))
+	}
+}
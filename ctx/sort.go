@@ -0,0 +1,155 @@
+package ctx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SortMode is the order in which the contents of a directory are listed.
+// Directories are always listed before files.
+type SortMode int
+
+const (
+	SortByName SortMode = iota
+	SortBySize
+	SortByModTime
+	SortByExtension
+	SortByType
+	numSortModes
+)
+
+var sortModeNames = [...]string{"name", "size", "mtime", "extension", "type"}
+
+func (m SortMode) String() string {
+	return sortModeNames[m]
+}
+
+// Next returns the sort mode that follows m, wrapping around to the first
+func (m SortMode) Next() SortMode {
+	return (m + 1) % numSortModes
+}
+
+// Sort files in place by the given mode. The sort is stable and ties are broken by name.
+func sortFiles(files []os.FileInfo, mode SortMode, descending bool) {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.IsDir() != b.IsDir() {
+			return a.IsDir()
+		}
+		if c := compareFiles(a, b, mode); c != 0 {
+			if descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return NaturalLess(a.Name(), b.Name())
+	})
+}
+
+// Compare two files by the key of the sort mode, returns -1, 0 or 1
+func compareFiles(a, b os.FileInfo, mode SortMode) int {
+	switch mode {
+	case SortByName:
+		return compareNatural(a.Name(), b.Name())
+	case SortBySize:
+		return compareInt(a.Size(), b.Size())
+	case SortByModTime:
+		return compareInt(a.ModTime().UnixNano(), b.ModTime().UnixNano())
+	case SortByExtension:
+		return strings.Compare(strings.ToLower(filepath.Ext(a.Name())), strings.ToLower(filepath.Ext(b.Name())))
+	case SortByType:
+		return compareInt(int64(typeRank(a)), int64(typeRank(b)))
+	}
+	return 0
+}
+
+// Order in which the types of files are listed when sorting by type
+func typeRank(f os.FileInfo) int {
+	mode := f.Mode()
+	switch {
+	case mode.IsDir():
+		return 0
+	case mode&os.ModeSymlink != 0:
+		return 1
+	case mode.IsRegular() && mode.Perm()&0111 != 0:
+		return 2
+	case mode.IsRegular():
+		return 3
+	}
+	return 4
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// NaturalLess returns true if a sorts before b in natural order, where runs of digits are
+// compared by their numeric value (eg. file2 < file10, v1.9 < v1.10).
+func NaturalLess(a, b string) bool {
+	return compareNatural(a, b) < 0
+}
+
+func compareNatural(a, b string) int {
+	if c := compareChunks(strings.ToLower(a), strings.ToLower(b)); c != 0 {
+		return c
+	}
+	// Names that differ only by case list lower case first, as ls does
+	return strings.Compare(b, a)
+}
+
+func compareChunks(a, b string) int {
+	for len(a) > 0 && len(b) > 0 {
+		var ca, cb string
+		ca, a = nextChunk(a)
+		cb, b = nextChunk(b)
+		if isDigit(ca[0]) && isDigit(cb[0]) {
+			// Compare numbers by length (ignoring leading zeros) and then digit by digit
+			na, nb := strings.TrimLeft(ca, "0"), strings.TrimLeft(cb, "0")
+			if c := compareInt(int64(len(na)), int64(len(nb))); c != 0 {
+				return c
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			if c := compareInt(int64(len(ca)), int64(len(cb))); c != 0 {
+				return c
+			}
+		} else if c := strings.Compare(ca, cb); c != 0 {
+			return c
+		}
+	}
+	return compareInt(int64(len(a)), int64(len(b)))
+}
+
+// Split off the leading run of digits or non-digits
+func nextChunk(s string) (string, string) {
+	digits := isDigit(s[0])
+	ii := 1
+	for ii < len(s) && isDigit(s[ii]) == digits {
+		ii++
+	}
+	return s[:ii], s[ii:]
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// ParseSortMode returns the sort mode with the given name
+func ParseSortMode(name string) (SortMode, error) {
+	for ii, n := range sortModeNames {
+		if n == name {
+			return SortMode(ii), nil
+		}
+	}
+	return SortByName, fmt.Errorf("unknown sort mode %q, expected one of %s", name, strings.Join(sortModeNames[:], ", "))
+}
@@ -0,0 +1,105 @@
+package ctx
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Minimal os.FileInfo for sorting tests
+type fakeFile struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (f fakeFile) Name() string       { return f.name }
+func (f fakeFile) Size() int64        { return f.size }
+func (f fakeFile) Mode() os.FileMode  { return f.mode }
+func (f fakeFile) ModTime() time.Time { return f.modTime }
+func (f fakeFile) IsDir() bool        { return f.mode.IsDir() }
+func (f fakeFile) Sys() interface{}   { return nil }
+
+func names(files []os.FileInfo) string {
+	s := make([]string, len(files))
+	for ii, f := range files {
+		s[ii] = f.Name()
+	}
+	return strings.Join(s, " ")
+}
+
+func TestNaturalLess(t *testing.T) {
+	ordered := []string{"a", "A", "a2", "a10", "a010", "b", "file1.txt", "file2.txt", "file10.txt",
+		"v1.9", "v1.10", "v1.10.1", "v2"}
+	for ii := 0; ii < len(ordered)-1; ii++ {
+		a, b := ordered[ii], ordered[ii+1]
+		if !NaturalLess(a, b) || NaturalLess(b, a) {
+			t.Error(fmt.Sprintf("Expected %s to sort before %s", a, b))
+		}
+	}
+}
+
+func TestSortFiles(t *testing.T) {
+	now := time.Now()
+	files := []os.FileInfo{
+		fakeFile{name: "c.txt", size: 30, mode: 0644, modTime: now},
+		fakeFile{name: "dir10", mode: os.ModeDir | 0755, modTime: now},
+		fakeFile{name: "a.go", size: 10, mode: 0644, modTime: now.Add(time.Hour)},
+		fakeFile{name: "run", size: 10, mode: 0755, modTime: now.Add(-time.Hour)},
+		fakeFile{name: "link", mode: os.ModeSymlink | 0777, modTime: now},
+		fakeFile{name: "dir2", mode: os.ModeDir | 0755, modTime: now},
+	}
+
+	cases := []struct {
+		mode       SortMode
+		descending bool
+		expected   string
+	}{
+		{SortByName, false, "dir2 dir10 a.go c.txt link run"},
+		{SortByName, true, "dir10 dir2 run link c.txt a.go"},
+		{SortBySize, false, "dir2 dir10 link a.go run c.txt"},
+		{SortBySize, true, "dir2 dir10 c.txt a.go run link"},
+		{SortByModTime, false, "dir2 dir10 run c.txt link a.go"},
+		{SortByExtension, false, "dir2 dir10 link run a.go c.txt"},
+		{SortByType, false, "dir2 dir10 link run a.go c.txt"},
+	}
+	for _, c := range cases {
+		sortFiles(files, c.mode, c.descending)
+		if found := names(files); found != c.expected {
+			t.Error(fmt.Sprintf("Sorting by %s (descending=%v): expected %q, found %q", c.mode, c.descending, c.expected, found))
+		}
+	}
+}
+
+func TestSetSortModeKeepsSelection(t *testing.T) {
+	err := setUp()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tearDown()
+
+	curDir, err := getDirChain()
+	if err != nil {
+		t.Error(err)
+	}
+	a := curDir.Parent.Parent
+	a.SelectFile("f1")
+	a.SetSortMode(SortByName, true)
+	f, _ := a.CurrentFile()
+	if f.Name() != "f1" {
+		t.Error(fmt.Sprintf("Expected f1 to be selected, found %s", f.Name()))
+	}
+	if expected := "A1 a1 f3 f2 f1"; names(a.Files) != expected {
+		t.Error(fmt.Sprintf("Expected %q, found %q", expected, names(a.Files)))
+	}
+
+	// Directories that are entered inherit the sort order
+	a.SelectFile("a1")
+	a1, _ := a.Descend()
+	if a1.SortMode != SortByName || !a1.SortDesc {
+		t.Error("Expected the sort order to be inherited")
+	}
+}
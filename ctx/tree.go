@@ -0,0 +1,39 @@
+package ctx
+
+import (
+	"os"
+	"path"
+)
+
+// Node is a file in a snapshot of a directory subtree
+type Node struct {
+	Info     os.FileInfo
+	Path     string  // Absolute path of the file
+	Children []*Node // Contents of the directory, if the file is a directory that was read
+	Err      error   // Error reading the contents of the directory
+}
+
+// Subtree reads the contents of the directory and its subdirectories down to the given depth,
+// where a depth of 1 reads only the contents of this directory and a depth <= 0 has no limit.
+// Subdirectories are listed with the same hidden file visibility and sort order as this directory.
+// If match is not nil then only the files whose names match are included, directories are
+// included if they match or contain a file that does.
+func (d *Directory) Subtree(depth int, match func(name string) bool) []*Node {
+	nodes := make([]*Node, 0, len(d.Files))
+	for _, f := range d.Files {
+		n := &Node{Info: f, Path: path.Join(d.AbsPath, f.Name())}
+
+		if f.IsDir() && depth != 1 {
+			child := &Directory{AbsPath: n.Path, FS: d.FS, Archive: d.Archive,
+				ShowHidden: d.ShowHidden, SortMode: d.SortMode, SortDesc: d.SortDesc}
+			if n.Err = child.UpdateContents(); n.Err == nil {
+				n.Children = child.Subtree(depth-1, match)
+			}
+		}
+
+		if match == nil || match(f.Name()) || len(n.Children) > 0 {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
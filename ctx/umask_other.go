@@ -0,0 +1,9 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package ctx
+
+// Processes do not have a umask on this platform
+func readUmask() uint32 {
+	return 0
+}
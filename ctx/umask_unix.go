@@ -0,0 +1,14 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package ctx
+
+import "syscall"
+
+// Returns the umask of the process. It can only be read by setting it, so it is read once before
+// anything else runs.
+func readUmask() uint32 {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return uint32(mask)
+}
@@ -0,0 +1,50 @@
+package ctx
+
+import (
+	"sort"
+	"sync"
+)
+
+// Watcher reports changes to the contents of a set of directories on the local disk.
+// Changes are collected until they are retrieved with Changed() and a notification is
+// sent on the Events() channel whenever there are new changes to be retrieved.
+type Watcher struct {
+	mu      sync.Mutex
+	changed map[string]bool
+	notify  chan struct{}
+	watches
+}
+
+func newWatcher() *Watcher {
+	return &Watcher{changed: make(map[string]bool), notify: make(chan struct{}, 1)}
+}
+
+// Events returns a channel that receives a value whenever a watched directory changes.
+// The channel is closed when the watcher is closed.
+func (w *Watcher) Events() <-chan struct{} {
+	return w.notify
+}
+
+// Changed returns the paths of the directories that have changed since the last call.
+func (w *Watcher) Changed() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	paths := make([]string, 0, len(w.changed))
+	for p := range w.changed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	w.changed = make(map[string]bool)
+	return paths
+}
+
+// Record a change to a directory and notify the listener without blocking
+func (w *Watcher) markChanged(p string) {
+	w.mu.Lock()
+	w.changed[p] = true
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
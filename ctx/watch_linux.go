@@ -0,0 +1,106 @@
+//go:build linux
+// +build linux
+
+package ctx
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+
+// inotify watch descriptors
+type watches struct {
+	fd    int
+	file  *os.File
+	wds   map[string]int
+	paths map[int]string
+}
+
+// Create a watcher that uses inotify to watch for changes
+func NewWatcher() (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := newWatcher()
+	w.fd = fd
+	// Wrapping the non-blocking descriptor in a file lets reads be interrupted by Close()
+	w.file = os.NewFile(uintptr(fd), "inotify")
+	w.wds = make(map[string]int)
+	w.paths = make(map[int]string)
+	go w.readEvents()
+	return w, nil
+}
+
+// Watch sets the directories being watched, any directories that were previously
+// watched and are not in paths are no longer watched.
+func (w *Watcher) Watch(paths []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wanted := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		wanted[p] = true
+	}
+	for p, wd := range w.wds {
+		if !wanted[p] {
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.wds, p)
+			delete(w.paths, wd)
+		}
+	}
+
+	var firstErr error
+	for p := range wanted {
+		if _, ok := w.wds[p]; ok {
+			continue
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, p, watchMask)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = &os.PathError{Op: "inotify_add_watch", Path: p, Err: err}
+			}
+			continue
+		}
+		w.wds[p] = wd
+		w.paths[wd] = p
+	}
+	return firstErr
+}
+
+// Close stops watching all directories
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
+
+func (w *Watcher) readEvents() {
+	defer close(w.notify)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			offset += syscall.SizeofInotifyEvent + int(ev.Len)
+
+			w.mu.Lock()
+			p, ok := w.paths[int(ev.Wd)]
+			if ok && ev.Mask&syscall.IN_IGNORED != 0 {
+				// The directory was removed, the kernel has already dropped the watch
+				delete(w.wds, p)
+				delete(w.paths, int(ev.Wd))
+			}
+			w.mu.Unlock()
+			if ok {
+				w.markChanged(p)
+			}
+		}
+	}
+}
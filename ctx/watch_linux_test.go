@@ -0,0 +1,46 @@
+package ctx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	err := setUp()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tearDown()
+
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	watched := testDirRoot + "/a/a1"
+	if err := w.Watch([]string{watched, testDirRoot + "/b"}); err != nil {
+		t.Fatal(err)
+	}
+	// Stop watching b, changes to it should no longer be reported
+	if err := w.Watch([]string{watched}); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(testDirRoot+"/b/new", nil, 0644)
+	ioutil.WriteFile(watched+"/new", nil, 0644)
+
+	select {
+	case <-w.Events():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for change notification")
+	}
+	changed := w.Changed()
+	if len(changed) != 1 || changed[0] != watched {
+		t.Error(fmt.Sprintf("Expected only %s to change, found %v", watched, changed))
+	}
+	if changed = w.Changed(); len(changed) != 0 {
+		t.Error(fmt.Sprintf("Expected changes to be cleared, found %v", changed))
+	}
+}
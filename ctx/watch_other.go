@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package ctx
+
+import "errors"
+
+type watches struct{}
+
+// Watching directories is only supported on linux
+func NewWatcher() (*Watcher, error) {
+	return nil, errors.New("watching directories is not supported on this platform")
+}
+
+func (w *Watcher) Watch(paths []string) error { return nil }
+func (w *Watcher) Close() error               { return nil }
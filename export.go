@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Machine readable representation of a file and, for directories, their contents
+type exportEntry struct {
+	Name     string         `json:"name"`
+	Path     string         `json:"path"`
+	Type     string         `json:"type"`
+	Size     int64          `json:"size"`
+	Mode     string         `json:"mode"`
+	ModTime  time.Time      `json:"mtime"`
+	Children []*exportEntry `json:"children,omitempty"`
+}
+
+// Formats that a directory tree can be exported to
+var exportFormats = []string{"json", "yaml", "ndjson"}
+
+func newExportEntry(name, p string, info os.FileInfo) *exportEntry {
+	return &exportEntry{
+		Name:    name,
+		Path:    p,
+		Type:    fileType(info.Mode()),
+		Size:    info.Size(),
+		Mode:    info.Mode().String(),
+		ModTime: info.ModTime(),
+	}
+}
+
+// Returns a description of the type of file
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeNamedPipe != 0:
+		return "pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	}
+	return "file"
+}
+
+// Create an export entry for the directory itself, with no children
+func exportDirectory(dir *ctx.Directory) (*exportEntry, error) {
+	info, err := dir.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return newExportEntry(path.Base(dir.AbsPath), dir.AbsPath, info), nil
+}
+
+// Convert the nodes of a subtree into export entries
+func exportNodes(nodes []*ctx.Node) []*exportEntry {
+	entries := make([]*exportEntry, len(nodes))
+	for ii, n := range nodes {
+		entries[ii] = newExportEntry(n.Info.Name(), n.Path, n.Info)
+		entries[ii].Children = exportNodes(n.Children)
+	}
+	return entries
+}
+
+// Export the directories of the view as they are shown on the screen. The files of the
+// top most directory are listed, and each directory of the view is nested in its parent.
+func exportDirView(dirlist ctx.DirView) (*exportEntry, error) {
+	root, err := exportDirectory(dirlist[0])
+	if err != nil {
+		return nil, err
+	}
+	parent := root
+	for level, dir := range dirlist {
+		var next *exportEntry
+		for _, f := range dir.Files {
+			e := newExportEntry(f.Name(), path.Join(dir.AbsPath, f.Name()), f)
+			if level < len(dirlist)-1 && e.Path == dirlist[level+1].AbsPath {
+				next = e
+			}
+			parent.Children = append(parent.Children, e)
+		}
+		if next == nil {
+			break
+		}
+		parent = next
+	}
+	return root, nil
+}
+
+// Returns the export format to use for a file name based on its extension
+func exportFormatOf(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	}
+	return "json"
+}
+
+// Write the entry and its children to w in the given format
+func writeExport(w io.Writer, format string, root *exportEntry) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(root)
+	case "ndjson":
+		return writeNDJSON(json.NewEncoder(w), root)
+	case "yaml":
+		return writeYAML(w, root, "", "")
+	}
+	return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(exportFormats, ", "))
+}
+
+// Write every entry as a separate JSON object on its own line, parents before their children
+func writeNDJSON(enc *json.Encoder, e *exportEntry) error {
+	flat := *e
+	flat.Children = nil
+	if err := enc.Encode(flat); err != nil {
+		return err
+	}
+	for _, c := range e.Children {
+		if err := writeNDJSON(enc, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the entry as a YAML mapping. Strings are written as JSON strings, which are valid YAML.
+// The first line is indented by first, which allows the entry to be an item of a sequence.
+func writeYAML(w io.Writer, e *exportEntry, indent, first string) error {
+	str := func(v string) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	lines := []string{
+		"name: " + str(e.Name),
+		"path: " + str(e.Path),
+		"type: " + e.Type,
+		"size: " + fmt.Sprint(e.Size),
+		"mode: " + str(e.Mode),
+		"mtime: " + e.ModTime.Format(time.RFC3339Nano),
+	}
+	if len(e.Children) > 0 {
+		lines = append(lines, "children:")
+	}
+	for ii, line := range lines {
+		prefix := indent
+		if ii == 0 {
+			prefix = first
+		}
+		if _, err := fmt.Fprintf(w, "%s%s\n", prefix, line); err != nil {
+			return err
+		}
+	}
+	for _, c := range e.Children {
+		if err := writeYAML(w, c, indent+"    ", indent+"  - "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the directory view to a file, the format is chosen by the file extension
+func exportToFile(filename string, dirlist ctx.DirView) (int, error) {
+	root, err := exportDirView(dirlist)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+	if err = writeExport(f, exportFormatOf(filename), root); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return countEntries(root.Children), f.Close()
+}
+
+func countEntries(entries []*exportEntry) int {
+	n := len(entries)
+	for _, e := range entries {
+		n += countEntries(e.Children)
+	}
+	return n
+}
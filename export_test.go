@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+func TestWriteExport(t *testing.T) {
+	dir, err := ctx.CreateDirectoryChainFS(printFS, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := exportDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.Children = exportNodes(dir.Subtree(2, nil))
+
+	out := bytes.Buffer{}
+	if err := writeExport(&out, "yaml", root); err != nil {
+		t.Fatal(err)
+	}
+	expected := `name: "root"
+path: "/root"
+type: directory
+size: 0
+mode: "dr-xr-xr-x"
+mtime: 0001-01-01T00:00:00Z
+children:
+  - name: "a"
+    path: "/root/a"
+    type: directory
+    size: 0
+    mode: "dr-xr-xr-x"
+    mtime: 0001-01-01T00:00:00Z
+    children:
+      - name: "b"
+        path: "/root/a/b"
+        type: directory
+        size: 0
+        mode: "dr-xr-xr-x"
+        mtime: 0001-01-01T00:00:00Z
+      - name: "y"
+        path: "/root/a/y"
+        type: file
+        size: 0
+        mode: "----------"
+        mtime: 0001-01-01T00:00:00Z
+  - name: "c"
+`
+	if !strings.HasPrefix(out.String(), expected) {
+		t.Error(fmt.Sprintf("Expected YAML to start with:\n%s\nFound:\n%s", expected, out.String()))
+	}
+
+	// Each line of NDJSON is a complete entry
+	out.Reset()
+	if err := writeExport(&out, "ndjson", root); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var e exportEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, e.Path)
+	}
+	if expected := "[/root /root/a /root/a/b /root/a/y /root/c /root/c/z]"; fmt.Sprint(paths) != expected {
+		t.Error(fmt.Sprintf("Expected %s, found %s", expected, paths))
+	}
+
+	if err := writeExport(&out, "xml", root); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func TestExportDirView(t *testing.T) {
+	dir, err := ctx.CreateDirectoryChainFS(printFS, "/root/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := exportDirView(ctx.DirView{dir.Parent, dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := bytes.Buffer{}
+	writeExport(&out, "json", root)
+
+	var decoded exportEntry
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Children) != 2 || len(decoded.Children[0].Children) != 2 || decoded.Children[1].Children != nil {
+		t.Error(fmt.Sprintf("Expected the contents of /root with /root/a nested, found:\n%s", out.String()))
+	}
+	if n := countEntries(root.Children); n != 4 {
+		t.Error(fmt.Sprintf("Expected 4 entries, found %d", n))
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/lobocv/itree/ctx"
+	"github.com/lobocv/itree/trash"
+)
+
+// Returns the absolute paths of the items that an action acts on: the marked items, or the
+// selected item if none are marked
+func (s *Screen) selectedPaths() []string {
+	if paths := s.markedPaths(); len(paths) > 0 {
+		return paths
+	}
+	if f, err := s.CurrentDir.CurrentFile(); err == nil {
+		return []string{path.Join(s.CurrentDir.AbsPath, f.Name())}
+	}
+	return nil
+}
+
+// Returns true if the items of the current directory can be changed, otherwise the reason is shown
+func (s *Screen) checkLocal() bool {
+	if !s.CurrentDir.IsLocal() {
+		s.setError(errors.New("files inside of archives cannot be changed"))
+		return false
+	}
+	return true
+}
+
+// Describes the items of a file operation for its prompt, by name if there is one
+func describeItems(paths []string) string {
+	if len(paths) == 1 {
+		return path.Base(paths[0])
+	}
+	return fmt.Sprintf("%d items", len(paths))
+}
+
+// Start typing the input of a file operation. The operation acts on the selected or marked items.
+// Items are copied and moved into the current directory unless a single directory is marked, then
+// the selected item is copied or moved into the marked directory.
+func (s *Screen) startFileOperation(mode CaptureMode) {
+	if !s.checkLocal() {
+		return
+	}
+	s.operands = s.selectedPaths()
+	needsItems := mode == modeRename || mode == modeCopy || mode == modeMove || mode == modeDelete
+	if needsItems && len(s.operands) == 0 {
+		s.setError(errors.New("no item selected"))
+		return
+	}
+	if mode == modeRename {
+		// Only the selected item is renamed, even if others are marked
+		f, _ := s.CurrentDir.CurrentFile()
+		s.operands = []string{path.Join(s.CurrentDir.AbsPath, f.Name())}
+	}
+	s.setCaptureMode(mode)
+	s.startCapturingInput()
+	switch mode {
+	case modeRename:
+		s.commandString = append(s.commandString[:0], []rune(path.Base(s.operands[0]))...)
+	case modeCopy, modeMove:
+		dest := s.CurrentDir.AbsPath
+		marked := s.markedPaths()
+		if f, err := s.CurrentDir.CurrentFile(); err == nil && len(marked) == 1 {
+			selected := path.Join(s.CurrentDir.AbsPath, f.Name())
+			if info, err := os.Stat(marked[0]); err == nil && info.IsDir() && selected != marked[0] {
+				dest = marked[0]
+				s.operands = []string{selected}
+			}
+		}
+		s.commandString = append(s.commandString[:0], []rune(strings.TrimSuffix(dest, "/")+"/")...)
+	}
+}
+
+// Returns the prompt of a file operation
+func (s *Screen) fileOperationPrompt() string {
+	input := string(s.commandString)
+	switch s.captureMode {
+	case modeRename:
+		return fmt.Sprintf("Rename %s to:  %s", describeItems(s.operands), input)
+	case modeNewDir:
+		return "Create the directory:  " + input
+	case modeNewFile:
+		return "Create the file:  " + input
+	case modeCopy:
+		return fmt.Sprintf("Copy %s to:  %s", describeItems(s.operands), input)
+	case modeMove:
+		return fmt.Sprintf("Move %s to:  %s", describeItems(s.operands), input)
+	case modeDelete:
+		return fmt.Sprintf("Move %s to the trash? (y/n)", describeItems(s.operands))
+	}
+	return ""
+}
+
+// Returns the absolute path of a path typed relative to the current directory
+func (s *Screen) absPath(p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(s.CurrentDir.AbsPath, p)
+}
+
+// Complete the path being typed with the names of the items that it matches
+func (s *Screen) completeCaptureInput() {
+	switch s.captureMode {
+	case modeNewDir, modeNewFile, modeCopy, modeMove, modeExport:
+	default:
+		return
+	}
+	completed, names := ctx.CompletePath(s.CurrentDir.AbsPath, string(s.commandString))
+	s.commandString = append(s.commandString[:0], []rune(completed)...)
+	s.completions = nil
+	if len(names) > 1 {
+		s.completions = names
+	}
+}
+
+// Perform the file operation with the input that was typed
+func (s *Screen) runFileOperation() {
+	input := strings.TrimSpace(string(s.commandString))
+	if input == "" {
+		return
+	}
+	var changed []string // Paths of the items that were created or removed
+	var ops []operation  // The changes to journal, so that they can be undone
+	var err error
+	var done string
+	switch s.captureMode {
+	case modeRename:
+		var dst string
+		if dst, err = ctx.Rename(s.operands[0], input); err == nil {
+			changed = append(changed, s.operands[0], dst)
+			ops = append(ops, operation{Kind: opMove, Src: s.operands[0], Dst: dst})
+			s.unmark(s.operands[0])
+			done = "Renamed to " + input
+		}
+	case modeNewDir:
+		dst := s.absPath(input)
+		top := firstMissing(dst)
+		if err = ctx.Mkdir(dst); err == nil {
+			ops = append(ops, operation{Kind: opMkdir, Src: top, Dst: dst})
+		}
+		changed = append(changed, dst)
+		done = "Created " + dst
+	case modeNewFile:
+		dst := s.absPath(input)
+		top := firstMissing(dst)
+		_, statErr := os.Lstat(dst)
+		existed := statErr == nil
+		if err = ctx.Touch(dst); err == nil && !existed {
+			ops = append(ops, operation{Kind: opCreate, Src: top, Dst: dst})
+		}
+		changed = append(changed, dst)
+		done = "Created " + dst
+	case modeCopy, modeMove:
+		op, verb, kind := ctx.Copy, "Copied", opCopy
+		if s.captureMode == modeMove {
+			op, verb, kind = ctx.Move, "Moved", opMove
+		}
+		dst := s.absPath(input)
+		for _, src := range s.operands {
+			var target string
+			if target, err = op(src, dst); err != nil {
+				break
+			}
+			changed = append(changed, src, target)
+			ops = append(ops, operation{Kind: kind, Src: src, Dst: target})
+			if s.captureMode == modeMove {
+				s.unmark(src)
+			}
+		}
+		done = fmt.Sprintf("%s %s to %s", verb, describeItems(s.operands), dst)
+	}
+	s.refreshItems(changed)
+	if err != nil {
+		s.setError(err)
+	} else if done != "" {
+		s.setStatus(done)
+	}
+	// Operations that partly succeeded are journaled too, so that what was done can be undone
+	s.journalOperations(done, ops)
+}
+
+// Move the items of the delete operation to the trash, they can be restored from the trash view
+func (s *Screen) deleteItems() {
+	var changed []string
+	var ops []operation
+	var err error
+	for _, p := range s.operands {
+		var item trash.Item
+		if item, err = trash.Put(p); err != nil {
+			break
+		}
+		changed = append(changed, p)
+		ops = append(ops, operation{Kind: opTrash, Src: p, Dst: item.Name, TrashDir: item.Trash.Dir, TopDir: item.Trash.TopDir})
+		s.unmark(p)
+	}
+	s.refreshItems(changed)
+	done := fmt.Sprintf("Moved %s to the trash", describeItems(s.operands))
+	if err != nil {
+		s.setError(err)
+	} else {
+		s.setStatus(done)
+	}
+	s.journalOperations(done, ops)
+}
+
+// Forget the mark of an item and everything in it, once it has been moved or deleted
+func (s *Screen) unmark(p string) {
+	for m := range s.marked {
+		if m == p || strings.HasPrefix(m, p+"/") {
+			delete(s.marked, m)
+		}
+	}
+}
+
+// Update the levels of the tree that contain items that were created or removed, including the
+// levels above them where parent directories may have been created. The last item is selected if
+// it is in the current directory.
+func (s *Screen) refreshItems(paths []string) {
+	changed := make(map[string]bool)
+	for _, p := range paths {
+		for dir := filepath.Dir(p); !changed[dir]; dir = filepath.Dir(dir) {
+			changed[dir] = true
+		}
+	}
+	s.refreshDirs(changed)
+	if len(paths) > 0 {
+		if last := paths[len(paths)-1]; filepath.Dir(last) == s.CurrentDir.AbsPath {
+			s.CurrentDir.SelectFile(filepath.Base(last))
+		}
+	}
+}
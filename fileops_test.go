@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Returns a screen in a new directory that contains the files, names ending in / are directories
+func fileOpsScreen(t *testing.T, names ...string) (*Screen, string) {
+	root := t.TempDir()
+	for _, name := range names {
+		p := filepath.Join(root, name)
+		if strings.HasSuffix(name, "/") {
+			os.MkdirAll(p, 0755)
+		} else if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir, err := ctx.CreateDirectoryChain(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := defaultConfig()
+	config.LSColors = false
+	s := newScreen(dir, newMemRenderer(80, 20), config)
+	s.keymap, _ = newKeymap("default", nil)
+	return s, root
+}
+
+// Set an environment variable for the duration of a test
+func setEnv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// Use a home trash in a temporary directory for the duration of a test, next to the directory
+// of the screen so that it is on the same file system
+func setTrashHome(t *testing.T, root string) {
+	setEnv(t, "XDG_DATA_HOME", filepath.Join(filepath.Dir(root), "data"))
+}
+
+// Handle the events of the keys of a key sequence
+func press(t *testing.T, s *Screen, keys string) {
+	for _, ev := range keyEvents(t, keys) {
+		if cmd := s.handleEvent(ev); cmd != nil {
+			t.Fatal(fmt.Sprintf("Expected %s not to exit", keys))
+		}
+	}
+}
+
+func TestFileOperations(t *testing.T) {
+	s, root := fileOpsScreen(t, "a", "b", "dir/")
+	setTrashHome(t, root)
+	// dir/ is listed first
+	press(t, s, "<Down>r<Backspace>renamed<Enter>")
+	if _, err := os.Stat(filepath.Join(root, "renamed")); err != nil || s.status != "Renamed to renamed" {
+		t.Error(fmt.Sprintf("Expected a to be renamed, found %v, status %q", err, s.status))
+	}
+	if f, _ := s.CurrentDir.CurrentFile(); f == nil || f.Name() != "renamed" {
+		t.Error(fmt.Sprintf("Expected the renamed item to be selected, found %v", f))
+	}
+
+	press(t, s, "nnew/sub<Enter>Nnew/sub/file<Enter>")
+	if _, err := os.Stat(filepath.Join(root, "new/sub/file")); err != nil {
+		t.Error(err)
+	}
+
+	// Copy into the marked directory
+	press(t, s, "<Home><Space><End>C<Enter>")
+	if _, err := os.Stat(filepath.Join(root, "dir/renamed")); err != nil || s.status == "" {
+		t.Error(fmt.Sprintf("Expected renamed to be copied into dir, found %v, status %q", err, s.status))
+	}
+
+	// Move the marked items to a typed path, stopping at the first error
+	press(t, s, "<Home><Space><Down><Space><Space>mdir<Enter>")
+	if _, err := os.Stat(filepath.Join(root, "dir/b")); err != nil {
+		t.Error(fmt.Sprintf("Expected b to be moved into dir, found %v", err))
+	}
+	if !strings.Contains(s.status, "renamed: file already exists") {
+		t.Error(fmt.Sprintf("Expected an error moving renamed into dir, which has a copy of it, found %q", s.status))
+	}
+	if fmt.Sprint(s.markedPaths()) != fmt.Sprint([]string{filepath.Join(root, "renamed")}) {
+		t.Error(fmt.Sprintf("Expected only renamed to stay marked, found %v", s.markedPaths()))
+	}
+
+	press(t, s, "D")
+	if prompt := s.fileOperationPrompt(); prompt != "Move renamed to the trash? (y/n)" {
+		t.Error(fmt.Sprintf("Expected to be asked to confirm, found %q", prompt))
+	}
+	press(t, s, "n")
+	if _, err := os.Stat(filepath.Join(root, "renamed")); err != nil {
+		t.Error("Expected n to cancel deleting")
+	}
+	press(t, s, "Dy")
+	if _, err := os.Stat(filepath.Join(root, "renamed")); err == nil || len(s.marked) != 0 {
+		t.Error("Expected y to delete renamed and forget its mark")
+	}
+	if s.status != "Moved renamed to the trash" {
+		t.Error(fmt.Sprintf("Expected renamed to be moved to the trash, found %q", s.status))
+	}
+
+	// Errors are shown on the status line
+	press(t, s, "nnew<Enter>")
+	if !strings.HasPrefix(s.status, "Error:") || !strings.Contains(s.status, "exists") {
+		t.Error(fmt.Sprintf("Expected an error creating a directory that exists, found %q", s.status))
+	}
+}
+
+func TestTrashView(t *testing.T) {
+	s, root := fileOpsScreen(t, "a", "b")
+	setTrashHome(t, root)
+	press(t, s, "Dy<Down>Dy")
+	if len(s.CurrentDir.Files) != 0 {
+		t.Fatal(fmt.Sprintf("Expected a and b to be moved to the trash, found %d items", len(s.CurrentDir.Files)))
+	}
+
+	press(t, s, "T")
+	view, ok := s.overlay.(*trashView)
+	if !ok || len(view.items) != 2 {
+		t.Fatal(fmt.Sprintf("Expected the trash to show 2 items, found %+v", s.overlay))
+	}
+	s.draw()
+	screen := s.renderer.(*memRenderer).String()
+	if !strings.Contains(screen, "2 items in the trash") || !strings.Contains(screen, filepath.Join(root, "a")) {
+		t.Error(fmt.Sprintf("Expected the items of the trash to be drawn, found\n%s", screen))
+	}
+
+	// Keys that are bound to actions do not reach the tree while the trash is shown
+	restored := view.items[1].Path
+	press(t, s, "<Down>D<Enter>")
+	if _, err := os.Stat(restored); err != nil || len(view.items) != 1 || s.status != "Restored "+restored {
+		t.Error(fmt.Sprintf("Expected an item to be restored, found %v, status %q", err, s.status))
+	}
+	if f, _ := s.CurrentDir.CurrentFile(); f == nil || filepath.Join(root, f.Name()) != restored {
+		t.Error(fmt.Sprintf("Expected the restored item to be selected, found %v", f))
+	}
+	press(t, s, "<Esc>")
+	if s.overlay != nil {
+		t.Error("Expected Esc to close the trash")
+	}
+}
+
+func TestCompleteCaptureInput(t *testing.T) {
+	s, _ := fileOpsScreen(t, "project/", "programs/", "readme")
+	press(t, s, "npr<Tab>")
+	if input := string(s.commandString); input != "pro" || len(s.completions) != 2 {
+		t.Error(fmt.Sprintf("Expected pro and two completions, found %q %v", input, s.completions))
+	}
+	press(t, s, "j<Tab>")
+	if input := string(s.commandString); input != "project/" || s.completions != nil {
+		t.Error(fmt.Sprintf("Expected project/, found %q %v", input, s.completions))
+	}
+}
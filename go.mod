@@ -2,10 +2,10 @@ module github.com/lobocv/itree
 
 require (
 	github.com/lithammer/fuzzysearch v1.1.1
-	github.com/mattn/go-runewidth v0.0.10 // indirect
+	github.com/mattn/go-runewidth v0.0.10
 	github.com/nsf/termbox-go v0.0.0-20210114135735-d04385b850e8
 	github.com/rivo/uniseg v0.2.0 // indirect
 	golang.org/x/text v0.3.5 // indirect
 )
 
-go 1.15
+go 1.16
@@ -3,7 +3,7 @@
 CWD=$(dirname $(readlink -e $0))
 INSTALL_PATH=/usr/local/bin/itree.sh
 BIN_INSTALL_PATH=/usr/local/bin/itree2
-PREFERENCES_FILE="${HOME}/.config/itree/preferences"
+CONFIG_FILE="${XDG_CONFIG_HOME:-${HOME}/.config}/itree/config.json"
 CUR_SHELL=$(basename $SHELL)
 ITREE_ALIAS="alias itree=\". itree.sh\""
 GOEXEC=$(which go)
@@ -32,7 +32,7 @@ if [ ! -f ${RC} ]; then
 fi
 
 echo "Installing to ${INSTALL_PATH}"
-sudo ${GOEXEC} build -o ${BIN_INSTALL_PATH} ${CWD}/itree.go
+sudo ${GOEXEC} build -o ${BIN_INSTALL_PATH} ${CWD}
 sudo cp ${CWD}/itree.sh ${INSTALL_PATH}
 
 ALIAS_EXISTS=$(grep "${ITREE_ALIAS}" ${RC})
@@ -44,6 +44,8 @@ else
     echo "${ITREE_ALIAS}" >> ${RC}
 fi
 
-mkdir -p $(dirname ${PREFERENCES_FILE}) 2>/dev/null
-echo "export EnterLastSelected=0" >> ${PREFERENCES_FILE}
-echo "export MaxUpperLevels=4" >> ${PREFERENCES_FILE}
+if [ ! -f "${CONFIG_FILE}" ]; then
+    echo "Writing the default configuration to ${CONFIG_FILE}"
+    mkdir -p "$(dirname "${CONFIG_FILE}")" 2>/dev/null
+    ${BIN_INSTALL_PATH} --default-config > "${CONFIG_FILE}"
+fi
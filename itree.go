@@ -2,15 +2,17 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
-	"math"
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 
+	"github.com/lithammer/fuzzysearch/fuzzy"
 	"github.com/nsf/termbox-go"
 
 	"github.com/lobocv/itree/ctx"
@@ -45,83 +47,171 @@ const (
 	modeSearch CaptureMode = iota
 	modeExitCommand
 	modeFilePerm
+	modeExport
+	modeRecursiveSearch
+	modeGrep
+	modeRename
+	modeNewDir
+	modeNewFile
+	modeCopy
+	modeMove
+	modeDelete
+	modeChown
 )
 
 type ExitCommand struct {
 	command string
 	args    []string
+	shell   Shell // Dialect of shell that the arguments are quoted for
 }
 
+// Returns the command followed by its arguments, which are quoted so that the shell
+// passes each of them to the command exactly as is.
 func (cmd *ExitCommand) FullCommand() string {
-	return cmd.command + " " + strings.Join(cmd.args, " ")
+	quoted := make([]string, len(cmd.args))
+	for ii, arg := range cmd.args {
+		quoted[ii] = cmd.shell.Quote(arg)
+	}
+	return cmd.command + " " + strings.Join(quoted, " ")
 }
 
 // Screen represents the application
 type Screen struct {
-	CurrentDir      *ctx.Directory
-	state           ScreenState
-	searchString    []rune
-	commandString   []rune
-	captureInput    bool
-	captureMode     CaptureMode
-	showPermissions bool
-	maxLevelWidth   int
+	CurrentDir        *ctx.Directory
+	renderer          Renderer // Where the screen is drawn and the events come from
+	state             ScreenState
+	searchString      []rune
+	commandString     []rune
+	captureInput      bool
+	captureMode       CaptureMode
+	showPermissions   bool
+	showPreview       bool
+	preview           previewCache  // The preview that was last drawn, which is drawn again until the item changes
+	onlyMatches       bool          // Hide the files that do not match the filter
+	matchMode         ctx.MatchMode // Engine used to match the search string when it has no prefix
+	filterErr         error         // Error in the search string, shown in the prompt
+	maxLevelWidth     int
+	maxUpperLevels    int      // Number of levels shown above the current directory
+	enterLastSelected bool     // Exit into the selected directory rather than the current one
+	keymap            *Keymap  // Actions bound to key sequences
+	pendingKeys       []string // Keys typed so far of a key sequence
+	watcher           *ctx.Watcher
+	dirView           ctx.DirView // The directories that were last drawn
+	status            string      // Message shown below the path until the next key press
+	statusColor       termbox.Attribute
+	marked            map[string]bool // Absolute paths of the marked items
+	results           *resultList     // Results shown in place of the tree, if any
+	overlay           overlay         // View shown in place of the tree, such as the trash, if any
+	journal           *journal        // Changes to the file system that can be undone
+	operands          []string        // Absolute paths of the items that the file operation being typed acts on
+	completions       []string        // Names that the path being typed could be completed with
+	async             chan func()     // Functions posted from the background to run on the main loop
+	view              viewport        // The rows of the tree that are shown
+	scrollMargin      int             // Rows kept visible above and below the selected item
+	hitboxes          []hitbox        // Where the items were last drawn, to find the item that is clicked
+	lastClick         click
 
 	highlightedColor termbox.Attribute
 	filteredColor    termbox.Attribute
+	markedColor      termbox.Attribute
+	matchAttr        termbox.Attribute // Added to the color of the characters that matched the filter
 	directoryColor   termbox.Attribute
 	fileColor        termbox.Attribute
+	theme            Theme              // Colors of the items, independent of the output mode
+	outputMode       termbox.OutputMode // Colors the terminal can show
+	lsColors         *LSColors          // Colors of the files by type and extension, nil to use the theme
+}
+
+// Move the selector by dy items. It stays where it is while no item is listed, which is when only the
+// matches are shown and nothing matches the filter.
+func (s *Screen) moveSelector(dy int) {
+	if len(s.CurrentDir.ListedFiles(s.onlyMatches)) == 0 {
+		return
+	}
+	s.CurrentDir.MoveSelector(dy)
 }
 
 // Move up by half the distance between the selected file
 // Always move at least 2 steps
 func (s *Screen) jumpUp() {
 	by := -max(2, s.CurrentDir.FileIdx/2)
-	s.CurrentDir.MoveSelector(by)
+	s.moveSelector(by)
 }
 
 // Move down by half the distance between the selected file
 // Always move at least 2 steps
 func (s *Screen) jumpDown() {
 	by := max(2, (len(s.CurrentDir.Files)-s.CurrentDir.FileIdx)/2)
-	s.CurrentDir.MoveSelector(by)
+	s.moveSelector(by)
 }
 
 // Prints text to the terminal at the provided position and color
 func (s *Screen) Print(x, y int, fg, bg termbox.Attribute, msg string) {
 	for _, c := range msg {
-		termbox.SetCell(x, y, c, fg, bg)
-		x++
+		w := runeWidth(c)
+		if w == 0 {
+			continue
+		}
+		s.renderer.SetCell(x, y, c, fg, bg)
+		x += w
+	}
+}
+
+// Returns the branch that connects the ii-th of n items in a directory to the tree
+func itemConnector(ii, n int) string {
+	if ii == n-1 {
+		return "└─"
+	}
+	return "├─"
+}
+
+// Returns the suffix that is appended to the name of an item to indicate its type
+func itemSuffix(f os.FileInfo) string {
+	if f.IsDir() {
+		return "/"
 	}
+	return ""
 }
 
-// Prints the structure of the directory path provided
-func (s *Screen) drawDirContents(x0, y0 int, dirlist ctx.DirView) error {
+// Prints the structure of the directory path provided.
+// The tree is drawn between x0 and maxX, it only overflows maxX if the view has a single directory.
+// Rows of the tree that do not fit between y0 and maxY are not drawn.
+func (s *Screen) drawDirContents(x0, y0, maxX, maxY int, dirlist ctx.DirView) error {
 	var levelOffsetX, levelOffsetY int // draw position offset
 	var stretch int                    // Length of line connecting subdirectories
 	var maxLineWidth int               // Length of longest item in the directory
 	var scrollOffsety int              // Offset to scroll the visible directory text by
 	var subDirSpacing = 2              // Spacing between subdirectories (on top of max item length)
 
-	screenWidth, screenHeight := termbox.Size()
+	s.hitboxes = s.hitboxes[:0]
 
 	levelOffsetX = x0
 	levelOffsetY = y0
 
-	// Determine the scrolling offset
-	scrollOffsety = levelOffsetY
-	for _, dir := range dirlist {
-		scrollOffsety += dir.FileIdx
+	// Only the files that match the filter are listed when showing only matches
+	listed := make([][]int, len(dirlist))
+	selectedRow := make([]int, len(dirlist))
+	for level, dir := range dirlist {
+		listed[level] = dir.ListedFiles(s.onlyMatches)
+		for row, ii := range listed[level] {
+			if ii == dir.FileIdx {
+				selectedRow[level] = row
+			}
+		}
 	}
-	// If the selected item is off the screen then shift the entire view up in order
-	// to make it visible.
-	scrollOffsety -= screenHeight - levelOffsetY
-	if scrollOffsety < 0 {
-		scrollOffsety = 0
-	} else {
-		pagejump := float64(screenHeight) / 5
-		scrollOffsety = int(math.Ceil(float64(scrollOffsety)/pagejump) * pagejump)
+
+	// Each level starts on the row of the selected item of the level above it. Find the row of the
+	// selected item of the current directory and the number of rows of the tree.
+	var selected, rows int
+	for level := range dirlist {
+		rows = max(rows, selected+len(listed[level]))
+		selected += selectedRow[level]
 	}
+	// Scroll the view to keep the selected item away from the edges of the screen
+	s.view.height = maxY - y0
+	s.view.margin = s.scrollMargin
+	s.view.follow(selected, rows)
+	scrollOffsety = s.view.top
 	lastLevel := len(dirlist) - 1
 	// Iterate through the directory list, drawing a tree structure
 	for level, dir := range dirlist {
@@ -130,10 +220,11 @@ func (s *Screen) drawDirContents(x0, y0 int, dirlist ctx.DirView) error {
 			maxLineWidth = 0
 		}
 
-		for ii, f := range dir.Files {
+		for row, ii := range listed[level] {
+			f := dir.Files[ii]
 
 			// Keep track of the longest length item in the directory
-			filenameLen := len(f.Name())
+			filenameLen := stringWidth(f.Name())
 			if s.maxLevelWidth == 0 && filenameLen > maxLineWidth {
 				maxLineWidth = filenameLen
 			}
@@ -145,84 +236,87 @@ func (s *Screen) drawDirContents(x0, y0 int, dirlist ctx.DirView) error {
 			} else {
 				if _, ok := dir.FilteredFiles[ii]; ok {
 					color = s.filteredColor
-				} else if f.IsDir() {
-					color = s.directoryColor
+				} else if s.marked[path.Join(dir.AbsPath, f.Name())] {
+					color = s.markedColor
 				} else {
-					color = s.fileColor
+					color = s.colorOf(f)
 				}
 
 			}
 
 			// Start creating the line to be printed
 			line := bytes.Buffer{}
-			if ii == 0 {
+			if row == 0 {
 				line.WriteString(strings.Repeat("─", stretch))
 			}
 
-			switch ii {
-			case 0:
-				if level > 0 {
-					if len(dir.Files) < 2 {
-						line.WriteString(strings.Repeat("─", subDirSpacing))
-					} else {
-						line.WriteString(strings.Repeat("─", subDirSpacing))
-						line.WriteString("┬─")
-					}
+			if row == 0 && level > 0 {
+				if len(listed[level]) < 2 {
+					line.WriteString(strings.Repeat("─", subDirSpacing))
 				} else {
-					line.WriteString(strings.Repeat(" ", subDirSpacing))
-					line.WriteString("├─")
+					line.WriteString(strings.Repeat("─", subDirSpacing))
+					line.WriteString("┬─")
 				}
-			case len(dir.Files) - 1:
-				line.WriteString(strings.Repeat(" ", subDirSpacing))
-				line.WriteString("└─")
-			default:
+			} else {
 				line.WriteString(strings.Repeat(" ", subDirSpacing))
-				line.WriteString("├─")
+				line.WriteString(itemConnector(row, len(listed[level])))
 			}
 
 			// Create the item label, add / if it is a directory
 			itemName := f.Name()
-			if maxLineWidth > 0 && len(itemName) > maxLineWidth {
-				line.WriteString(itemName[:min(len(itemName), maxLineWidth-3)])
+			nameOffset := stringWidth(line.String())
+			if maxLineWidth > 0 && stringWidth(itemName) > maxLineWidth {
+				itemName = truncate(itemName, maxLineWidth-3)
+				line.WriteString(itemName)
 				line.WriteString("...")
 			} else {
 				line.WriteString(itemName)
 			}
-
-			if f.IsDir() {
-				line.WriteString("/")
-			}
+			line.WriteString(itemSuffix(f))
+			nameEnd := stringWidth(line.String())
 			if level == lastLevel && s.showPermissions {
 				line.WriteString("\t")
 				line.WriteString(f.Mode().Perm().String())
 			}
 			// Calculate the draw position
-			y := levelOffsetY + ii - scrollOffsety
+			y := levelOffsetY + row - scrollOffsety
 			x := levelOffsetX
-			if ii == 0 {
+			if row == 0 {
 				// The first item is connected to the parent directory with a line
 				// shift the position left to account for this line
 				x -= stretch
 			}
-			if x+len(line.String()) > screenWidth && len(dirlist) > 1 {
+			if x+stringWidth(line.String()) > maxX && len(dirlist) > 1 {
 				return errors.New("DisplayOverflow")
 			}
-			if y < y0 {
-				y = y0
+			if y < y0 || y >= maxY {
+				// Rows of the levels above that are scrolled off the screen are left out
+				continue
 			}
 			s.Print(x, y, color, termbox.ColorDefault, line.String())
+			s.hitboxes = append(s.hitboxes, hitbox{x0: x + nameOffset, x1: x + nameEnd, y: y, dir: dir, idx: ii})
+
+			// Highlight the characters of the name that matched the filter
+			if m, ok := dir.FilteredFiles[ii]; ok {
+				nameRunes := []rune(itemName)
+				for _, pos := range m.Positions {
+					if pos < len(nameRunes) && runeWidth(nameRunes[pos]) > 0 {
+						s.renderer.SetCell(x+nameOffset+runesWidth(itemName, pos), y, nameRunes[pos], color|s.matchAttr, termbox.ColorDefault)
+					}
+				}
+			}
 		}
 
 		// Determine the length of line we need to draw to connect to the next directory
 		if len(dir.Files) > 0 {
-			stretch = maxLineWidth - len(dir.Files[dir.FileIdx].Name())
+			stretch = maxLineWidth - stringWidth(dir.Files[dir.FileIdx].Name())
 			if stretch < 0 {
 				stretch = 0
 			}
 		}
 
 		// Shift the draw position in preparation for the next directory
-		levelOffsetY += dir.FileIdx
+		levelOffsetY += selectedRow[level]
 		levelOffsetX += maxLineWidth + 2 + subDirSpacing
 
 	}
@@ -253,61 +347,87 @@ func (s *Screen) draw() {
 			"                           CONTROLS                             ",
 			"================================================================",
 		}
-		hotkeys := []struct{ hotkey, description string }{
-			{"Left / Right", "Enter / exit currently selected directory"},
-			{"Up / Down", "Move directory item selector position by one"},
-			{"ESC or q", "Exit and change directory"},
-			{"CTRL + C", "Exit without changing directory"},
-			{"CTRL + h", "Opens help menu to show the list of hotkey mappings"},
-			{"h", "Toggle on / off visibility of hidden files"},
-			{"e", "Move selector half the distance between the current position and the top of the directory"},
-			{"d", "Move selector half the distance between the current position and the bottom of the directory"},
-			{"c", "Toggle position"},
-			{"a", "Jump up two directories"},
-			{"p", "Show file permissions"},
-			{"CTRL + p", "Set file permissions bitmask (eg 644, 777, 400)"},
-			{"/", "Enters input capture mode for directory filtering"},
-			{":", "Enters input capture mode for exit command"},
-		}
 		s.clearScreen()
 		for _, line := range help {
 			s.Print(0, lc, termbox.ColorWhite, termbox.ColorDefault, line)
 			lc++
 		}
 		lc++
-		for _, hotkey := range hotkeys {
-			hk := fmt.Sprintf("%-12v -  ", hotkey.hotkey)
-			s.Print(0, lc, termbox.ColorWhite, termbox.ColorDefault, hk)
-			s.Print(len(hk), lc, termbox.ColorWhite, termbox.ColorDefault, hotkey.description)
+		for _, line := range s.helpLines() {
+			s.Print(0, lc, termbox.ColorWhite, termbox.ColorDefault, line)
 			lc++
 		}
 		lc += 2
-		s.Print(0, lc, termbox.ColorWhite, termbox.ColorDefault, "Press q to exit this menu.")
+		s.Print(0, lc, termbox.ColorWhite, termbox.ColorDefault, "Press Enter to confirm input, or Esc to cancel it.")
+		lc++
+		if keys := s.keymap.keysFor("quit"); len(keys) > 0 {
+			s.Print(0, lc, termbox.ColorWhite, termbox.ColorDefault, fmt.Sprintf("Press %s to exit this menu.", keys[0]))
+		}
 
 	case Directory:
-		upperLevels, err := strconv.Atoi(os.Getenv("MaxUpperLevels"))
-		if err != nil {
-			upperLevels = 3
-		}
+		upperLevels := s.maxUpperLevels
 		for {
 			s.clearScreen()
 			var instruction string
-			// Print the current path
+			// Print the current path and the order that the files are sorted by
 			s.Print(0, 0, termbox.ColorRed, termbox.ColorDefault, s.CurrentDir.AbsPath)
+			header := s.sortDescription()
+			if len(s.marked) > 0 {
+				header += fmt.Sprintf("  [%d marked]", len(s.marked))
+			}
+			if s.onlyMatches {
+				header += "  [only matches]"
+			}
+			s.Print(stringWidth(s.CurrentDir.AbsPath)+2, 0, termbox.ColorWhite, termbox.ColorDefault, header)
 			if s.captureInput {
 				switch s.captureMode {
 				case modeSearch:
-					instruction = "Enter a search string:  " + string(s.searchString)
-				case modeFilePerm:
-					instruction = "Enter the file permissions:  " + string(s.commandString)
+					mode, _ := ctx.ParseQuery(string(s.searchString), s.matchMode)
+					instruction = fmt.Sprintf("Enter a search string (%s):  %s", mode, string(s.searchString))
+				case modeFilePerm, modeChown:
+					instruction, _, _ = s.permissionPrompt()
 				case modeExitCommand:
 					instruction = "Enter a terminal command and hit enter:  " + string(s.commandString)
+				case modeExport:
+					instruction = "Export the view to file (.json, .yaml or .ndjson):  " + string(s.commandString)
+				case modeRecursiveSearch:
+					instruction = "Search below the current directory:  " + string(s.searchString)
+				case modeGrep:
+					instruction = "Search the contents of the files below the current directory:  " + string(s.searchString)
+				case modeRename, modeNewDir, modeNewFile, modeCopy, modeMove, modeDelete:
+					instruction = s.fileOperationPrompt()
 				}
 				s.Print(0, 1, termbox.ColorWhite, termbox.ColorDefault, instruction)
+				if s.captureMode == modeSearch && s.filterErr != nil {
+					s.Print(stringWidth(instruction)+2, 1, termbox.ColorRed, termbox.ColorDefault, s.filterErr.Error())
+				} else if _, preview, color := s.permissionPrompt(); preview != "" {
+					s.Print(stringWidth(instruction)+2, 1, color, termbox.ColorDefault, preview)
+				} else if len(s.completions) > 0 {
+					s.Print(stringWidth(instruction)+2, 1, termbox.ColorBlue, termbox.ColorDefault, strings.Join(s.completions, "  "))
+				}
+			} else if s.status != "" {
+				s.Print(0, 1, s.statusColor, termbox.ColorDefault, s.status)
+			}
+			if s.results != nil {
+				s.drawResultList(s.results, 2)
+				s.hitboxes = nil
+				break
 			}
+			if s.overlay != nil {
+				s.overlay.draw(s, 2)
+				s.hitboxes = nil
+				break
+			}
+			screenWidth, screenHeight := s.renderer.Size()
+			paneWidth := s.previewWidth(screenWidth)
 			dirlist := s.getDirView(upperLevels)
-			err := s.drawDirContents(0, 2, dirlist)
+			err := s.drawDirContents(0, 2, screenWidth-paneWidth, screenHeight, dirlist)
 			if err == nil {
+				if paneWidth > 0 {
+					s.drawPreview(screenWidth-paneWidth, 2, paneWidth, screenHeight-2)
+				}
+				s.dirView = dirlist
+				s.watchDirs(dirlist)
 				break
 			} else {
 				upperLevels -= 1
@@ -315,12 +435,12 @@ func (s *Screen) draw() {
 		}
 	}
 
-	termbox.Flush()
+	s.renderer.Flush()
 }
 
 // Clear the contents of the screen
 func (s *Screen) clearScreen() {
-	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	s.renderer.Clear(termbox.ColorDefault, termbox.ColorDefault)
 }
 
 // Get a subset of the directory chain as a slice where the last element is the current directory
@@ -341,10 +461,73 @@ func (s *Screen) getDirView(upperLevels int) ctx.DirView {
 	return dirlist
 }
 
+// Watch the visible directories for changes to their contents
+func (s *Screen) watchDirs(dirlist ctx.DirView) {
+	if s.watcher == nil {
+		return
+	}
+	paths := make([]string, 0, len(dirlist))
+	for _, dir := range dirlist {
+		if dir.IsLocal() {
+			paths = append(paths, dir.AbsPath)
+		}
+	}
+	s.watcher.Watch(paths)
+}
+
+// Refresh the changed directories whenever a watched directory changes
+func (s *Screen) forwardWatchEvents() {
+	for range s.watcher.Events() {
+		s.post(s.refreshChangedDirs)
+	}
+}
+
+// Run a function on the main loop, waking it up if it is waiting for input.
+// This is how work done in the background changes the state of the screen.
+func (s *Screen) post(fn func()) {
+	s.async <- fn
+	s.renderer.Interrupt()
+}
+
+// Run the functions that have been posted to the main loop
+func (s *Screen) runPosted() {
+	for {
+		select {
+		case fn := <-s.async:
+			fn()
+		default:
+			return
+		}
+	}
+}
+
+// Reload the contents of the directories that have changed.
+// If the current directory no longer exists then move up to the closest parent that does.
+func (s *Screen) refreshChangedDirs() {
+	changed := make(map[string]bool)
+	for _, p := range s.watcher.Changed() {
+		changed[p] = true
+	}
+	s.refreshDirs(changed)
+}
+
+// Update the contents of the directories of the chain with the given paths. If the current
+// directory no longer exists then its parent becomes the current directory.
+func (s *Screen) refreshDirs(changed map[string]bool) {
+	for dir := s.CurrentDir; dir != nil; dir = dir.Parent {
+		if !changed[dir.AbsPath] {
+			continue
+		}
+		if err := dir.UpdateContents(); err != nil && dir == s.CurrentDir && dir.Parent != nil {
+			s.CurrentDir = dir.Parent
+			changed[dir.Parent.AbsPath] = true
+		}
+	}
+}
+
 // Enters the currently selected directory
 func (s *Screen) enterCurrentDirectory() {
 	dir := s.CurrentDir
-	dir.Descend()
 	s.searchString = s.searchString[:0]
 	dir.FilterContents(string(s.searchString))
 	nextdir, err := dir.Descend()
@@ -379,7 +562,17 @@ func (s *Screen) startCapturingInput() {
 		s.searchString = s.searchString[:]
 	case modeExitCommand:
 		s.commandString = s.commandString[:]
-	case modeFilePerm:
+	case modeFilePerm, modeChown:
+		s.commandString = s.commandString[:0]
+	case modeExport:
+		s.commandString = append(s.commandString[:0], []rune("itree.json")...)
+	case modeRecursiveSearch:
+		s.searchString = s.searchString[:0]
+		s.startRecursiveSearch()
+	case modeGrep:
+		s.searchString = s.searchString[:0]
+		s.startGrep()
+	case modeRename, modeNewDir, modeNewFile, modeCopy, modeMove, modeDelete:
 		s.commandString = s.commandString[:0]
 	}
 
@@ -388,10 +581,32 @@ func (s *Screen) startCapturingInput() {
 // Exits the mode to capture input
 func (s *Screen) stopCapturingInput() {
 	s.captureInput = false
-	if s.captureMode == modeSearch {
+	switch s.captureMode {
+	case modeSearch:
+		// The filter is kept until it is cleared, so that it can be browsed and restricted to its matches
+		s.filterErr = nil
+	case modeRecursiveSearch, modeGrep:
 		s.searchString = s.searchString[:0]
-		s.CurrentDir.FilterContents(string(s.searchString))
+		s.closeResults()
+	case modeRename, modeNewDir, modeNewFile, modeCopy, modeMove, modeDelete, modeFilePerm, modeChown:
+		s.operands = nil
 	}
+	s.completions = nil
+}
+
+// Exits the mode to capture input without confirming it, which also clears the filter
+func (s *Screen) cancelCaptureInput() {
+	if s.captureMode == modeSearch {
+		s.clearFilter()
+	}
+	s.stopCapturingInput()
+}
+
+// Remove the filter of the current directory
+func (s *Screen) clearFilter() {
+	s.searchString = s.searchString[:0]
+	s.filterErr = nil
+	s.CurrentDir.FilterContents("")
 }
 
 // Add a character to the currently capturing string
@@ -399,9 +614,22 @@ func (s *Screen) appendToCaptureInput(ch rune) {
 	switch s.captureMode {
 	case modeSearch:
 		s.searchString = append(s.searchString, ch)
-		s.CurrentDir.FilterContents(string(s.searchString))
-	case modeExitCommand, modeFilePerm:
+		s.applyFilter()
+	case modeRecursiveSearch:
+		s.searchString = append(s.searchString, ch)
+		s.startRecursiveSearch()
+	case modeGrep:
+		s.searchString = append(s.searchString, ch)
+		s.startGrep()
+	case modeExitCommand, modeFilePerm, modeChown, modeExport, modeRename, modeNewDir, modeNewFile, modeCopy, modeMove:
 		s.commandString = append(s.commandString, ch)
+		s.completions = nil
+	case modeDelete:
+		// Any key other than y cancels
+		if ch == 'y' || ch == 'Y' {
+			s.deleteItems()
+		}
+		s.stopCapturingInput()
 	}
 }
 
@@ -411,18 +639,85 @@ func (s *Screen) popFromCaptureInput() {
 	case modeSearch:
 		if len(s.searchString) > 0 {
 			s.searchString = s.searchString[:len(s.searchString)-1]
-			s.CurrentDir.FilterContents(string(s.searchString))
+			s.applyFilter()
+		}
+	case modeRecursiveSearch:
+		if len(s.searchString) > 0 {
+			s.searchString = s.searchString[:len(s.searchString)-1]
+			s.startRecursiveSearch()
+		}
+	case modeGrep:
+		if len(s.searchString) > 0 {
+			s.searchString = s.searchString[:len(s.searchString)-1]
+			s.startGrep()
 		}
-	case modeExitCommand, modeFilePerm:
+	case modeExitCommand, modeFilePerm, modeChown, modeExport, modeRename, modeNewDir, modeNewFile, modeCopy, modeMove:
 		if len(s.commandString) > 0 {
 			s.commandString = s.commandString[:len(s.commandString)-1]
 		}
+		s.completions = nil
+	}
+
+}
+
+// Filter the current directory with the search string. A prefix in the search string selects the
+// match engine, otherwise the current match mode is used. If the search string is not a valid
+// pattern the previous filter is kept and the error is shown in the prompt.
+func (s *Screen) applyFilter() {
+	mode, pattern := ctx.ParseQuery(string(s.searchString), s.matchMode)
+	s.filterErr = nil
+	if pattern == "" {
+		s.CurrentDir.FilterWith(nil)
+		return
+	}
+	m, err := ctx.NewMatcher(mode, pattern)
+	if err != nil {
+		s.filterErr = err
+		return
 	}
+	s.CurrentDir.FilterWith(m)
+}
 
+// Switch to the next match engine for the search string
+func (s *Screen) cycleMatchMode() {
+	s.matchMode = s.matchMode.Next()
+	if s.captureInput && s.captureMode == modeSearch {
+		s.applyFilter()
+	} else {
+		s.setStatus(fmt.Sprintf("Search mode: %s", s.matchMode))
+	}
+}
+
+// Handle the keys that navigate the list of results, returns true if the key was handled
+func (s *Screen) handleResultKey(ev termbox.Event) bool {
+	if ev.Type != termbox.EventKey {
+		return false
+	}
+	switch ev.Key {
+	case termbox.KeyArrowUp:
+		s.results.move(-1)
+	case termbox.KeyArrowDown:
+		s.results.move(1)
+	case termbox.KeyPgup:
+		s.results.move(-10)
+	case termbox.KeyPgdn:
+		s.results.move(10)
+	case termbox.KeyEnter:
+		if err := s.jumpToResult(); err != nil {
+			s.setError(err)
+		}
+		s.stopCapturingInput()
+	default:
+		return false
+	}
+	return true
 }
 
 // Toggle position between first and last file in the directory
 func (s *Screen) toggleIndexToExtremities() {
+	if len(s.CurrentDir.ListedFiles(s.onlyMatches)) == 0 {
+		return
+	}
 	if s.CurrentDir.FileIdx == 0 {
 		s.CurrentDir.FileIdx = len(s.CurrentDir.Files) - 1
 	} else {
@@ -430,119 +725,226 @@ func (s *Screen) toggleIndexToExtremities() {
 	}
 }
 
+// Show a message below the path until the next key press
+func (s *Screen) setStatus(msg string) {
+	s.status = msg
+	s.statusColor = termbox.ColorWhite
+}
+
+// Show an error below the path until the next key press
+func (s *Screen) setError(err error) {
+	s.status = fmt.Sprintf("Error: %v", err)
+	s.statusColor = termbox.ColorRed
+}
+
+// Export the view to a file. Relative paths are relative to the current directory.
+func (s *Screen) exportView(filename string) {
+	dir := s.CurrentDir
+	for !dir.IsLocal() && dir.Parent != nil {
+		dir = dir.Parent
+	}
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir.AbsPath, filename)
+	}
+	n, err := exportToFile(filename, s.dirView)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	s.setStatus(fmt.Sprintf("Exported %d entries to %s", n, filename))
+}
+
+// Toggle the mark on the selected item and move on to the next item
+func (s *Screen) toggleMark() {
+	f, err := s.CurrentDir.CurrentFile()
+	if err != nil {
+		return
+	}
+	if !s.CurrentDir.IsLocal() {
+		s.setError(errors.New("items inside of archives cannot be marked"))
+		return
+	}
+	p := path.Join(s.CurrentDir.AbsPath, f.Name())
+	if s.marked[p] {
+		delete(s.marked, p)
+	} else {
+		s.marked[p] = true
+	}
+	s.moveSelector(1)
+}
+
+// Returns the absolute paths of the marked items in sorted order
+func (s *Screen) markedPaths() []string {
+	paths := make([]string, 0, len(s.marked))
+	for p := range s.marked {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Change the order that files are listed in for all directories in the chain
+func (s *Screen) setSortMode(mode ctx.SortMode, descending bool) {
+	for dir := s.CurrentDir; dir != nil; dir = dir.Parent {
+		dir.SetSortMode(mode, descending)
+	}
+}
+
+// Describes the order that the files are listed in
+func (s *Screen) sortDescription() string {
+	order := "ascending"
+	if s.CurrentDir.SortDesc {
+		order = "descending"
+	}
+	return fmt.Sprintf("[sort: %s, %s]", s.CurrentDir.SortMode, order)
+}
+
 // Toggle position between first and last file in the directory
 func (s *Screen) togglePermissions() {
 	s.showPermissions = !s.showPermissions
 }
 
+// Toggle the pane that previews the selected item
+func (s *Screen) togglePreview() {
+	s.showPreview = !s.showPreview
+}
+
+// Toggle between listing all files and only the files that match the filter
+func (s *Screen) toggleOnlyMatches() {
+	s.onlyMatches = !s.onlyMatches
+}
+
+// Returns a screen in the directory that draws on the renderer
+func newScreen(dir *ctx.Directory, r Renderer, config Config) *Screen {
+	s := &Screen{searchString: make([]rune, 0, 100),
+		commandString:   make([]rune, 0, 100),
+		CurrentDir:      dir,
+		renderer:        r,
+		marked:          make(map[string]bool),
+		journal:         &journal{},
+		async:           make(chan func(), 64),
+		state:           Directory,
+		captureMode:     modeSearch,
+		showPermissions: false,
+		matchAttr:       termbox.AttrBold | termbox.AttrUnderline,
+	}
+	s.applyConfig(config)
+	return s
+}
+
 // Main loop of the application
 func (s *Screen) Main() ExitCommand {
+	if s.keymap == nil {
+		s.keymap, _ = newKeymap("default", nil)
+	}
+	if s.watcher != nil {
+		go s.forwardWatchEvents()
+	}
 
-MainLoop:
 	for {
 		s.draw()
-
-		ev := termbox.PollEvent()
-		if s.captureInput {
-			if ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlC {
-				s.stopCapturingInput()
-				continue
-			} else if ev.Key == termbox.KeyBackspace2 || ev.Key == termbox.KeyBackspace {
-				s.popFromCaptureInput()
-			} else if ev.Ch != 0 || ev.Key == termbox.KeySpace {
-				s.appendToCaptureInput(ev.Ch)
-				continue MainLoop
-			}
+		if cmd := s.handleEvent(s.renderer.PollEvent()); cmd != nil {
+			return *cmd
 		}
+	}
+}
 
-		switch ev.Type {
-		case termbox.EventKey:
-			switch ev.Key {
-			case termbox.KeyEsc:
-				if s.state == Help {
-					s.toggleHelp()
-				} else {
-					break MainLoop
-				}
-			case termbox.KeyCtrlC:
-				return ExitCommand{"", nil}
-			case termbox.KeyArrowUp:
-				s.CurrentDir.MoveSelector(-1)
-			case termbox.KeyArrowDown:
-				s.CurrentDir.MoveSelector(1)
-			case termbox.KeyArrowLeft:
-				s.exitCurrentDirectory()
-			case termbox.KeyArrowRight:
-				s.enterCurrentDirectory()
-			case termbox.KeyPgup:
-				s.jumpUp()
-			case termbox.KeyPgdn:
-				s.jumpDown()
-			case termbox.KeyCtrlH:
-				s.toggleHelp()
-			case termbox.KeyCtrlP:
-				s.setCaptureMode(modeFilePerm)
-				s.startCapturingInput()
-			case termbox.KeyEnter:
-				if s.captureInput {
-					if curFile, err := s.CurrentDir.CurrentFile(); err == nil {
-						switch s.captureMode {
-						case modeExitCommand:
-							return ExitCommand{command: string(s.commandString),
-								args: []string{path.Join(s.CurrentDir.AbsPath, curFile.Name())}}
-						case modeFilePerm:
-							m, err := strconv.ParseUint(string(s.commandString), 8, 64)
-							if err == nil {
-								err = os.Chmod(curFile.Name(), os.FileMode(m))
-								if err != nil {
-									fatal(err)
-								}
-								s.CurrentDir.UpdateContents()
-							}
-						}
-					}
-					s.stopCapturingInput()
-				}
-			}
-			switch ev.Ch {
-			case 'q':
-				if s.state == Help {
-					s.toggleHelp()
-				} else {
-					break MainLoop
-				}
-			case '/':
-				s.setCaptureMode(modeSearch)
-				s.startCapturingInput()
-			case ':':
-				s.setCaptureMode(modeExitCommand)
-				s.startCapturingInput()
-			case 'h':
-				s.CurrentDir.SetShowHidden(!s.CurrentDir.ShowHidden)
-			case 'a':
-				s.exitCurrentDirectory()
-				s.exitCurrentDirectory()
-			case 'e':
-				s.jumpUp()
-			case 'd':
-				s.jumpDown()
-			case 'p':
-				s.togglePermissions()
-			case 'c':
-				s.toggleIndexToExtremities()
+// Handle an event of the renderer, returns the command to exit with if the event ends the application
+func (s *Screen) handleEvent(ev termbox.Event) *ExitCommand {
+	if s.results != nil && s.handleResultKey(ev) {
+		return nil
+	}
+	if s.overlay != nil && ev.Type == termbox.EventKey {
+		// The view takes every key, the keys that it does not use are ignored. Only the key that
+		// exits without changing directory works in every view.
+		s.status = ""
+		key := keyName(ev.Ch, ev.Key)
+		for _, keys := range s.keymap.keysFor("quit-no-cd") {
+			if keys == key {
+				s.overlay = nil
+				return s.handleKey(key)
 			}
 		}
+		s.overlay.handleKey(s, ev)
+		return nil
+	}
+	if s.captureInput {
+		if ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlC {
+			s.cancelCaptureInput()
+			return nil
+		} else if ev.Key == termbox.KeyBackspace2 || ev.Key == termbox.KeyBackspace {
+			s.popFromCaptureInput()
+			return nil
+		} else if ev.Key == termbox.KeySpace {
+			s.appendToCaptureInput(' ')
+			return nil
+		} else if ev.Key == termbox.KeyTab {
+			s.completeCaptureInput()
+			return nil
+		} else if ev.Ch != 0 {
+			s.appendToCaptureInput(ev.Ch)
+			return nil
+		} else if ev.Key == termbox.KeyEnter {
+			return s.confirmCaptureInput()
+		}
+	}
 
+	switch ev.Type {
+	case termbox.EventInterrupt:
+		s.runPosted()
+	case termbox.EventResize:
+		// The screen is cleared at its new size and redrawn at the top of the loop, the view
+		// scrolls to keep the selected item in it
+	case termbox.EventMouse:
+		s.handleMouse(ev)
+	case termbox.EventKey:
+		s.status = ""
+		if ev.Key == termbox.KeyEsc && s.CurrentDir.Filtered() {
+			// Esc clears a filter that was confirmed before it quits
+			s.clearFilter()
+			return nil
+		}
+		return s.handleKey(keyName(ev.Ch, ev.Key))
 	}
+	return nil
+}
 
-	// Return the directory we end up in
-	currentItem, err := s.CurrentDir.CurrentFile()
-	if err == nil && currentItem.IsDir() && os.Getenv("EnterLastSelected") == "1" {
-		return ExitCommand{command: "cd", args: []string{path.Join(s.CurrentDir.AbsPath, currentItem.Name())}}
-	} else {
-		return ExitCommand{command: "cd", args: []string{s.CurrentDir.AbsPath}}
+// Confirm the captured input, returns the command to exit with if the input was an exit command
+func (s *Screen) confirmCaptureInput() *ExitCommand {
+	defer s.stopCapturingInput()
+	switch s.captureMode {
+	case modeRename, modeNewDir, modeNewFile, modeCopy, modeMove:
+		s.runFileOperation()
+		return nil
+	case modeFilePerm, modeChown:
+		s.runPermissionChange()
+		return nil
 	}
+	if _, err := s.CurrentDir.CurrentFile(); err != nil {
+		return nil
+	}
+	switch s.captureMode {
+	case modeExitCommand:
+		// The command acts on the marked items, or the selected item if none are marked
+		return &ExitCommand{command: string(s.commandString), args: s.selectedPaths()}
+	case modeExport:
+		s.exportView(string(s.commandString))
+	}
+	return nil
+}
 
+// Returns the command that changes to the directory we end up in. Archives cannot be entered by
+// the shell so leave from the directory that contains the archive.
+func (s *Screen) cdCommand() ExitCommand {
+	dir := s.CurrentDir
+	for dir.Archive != "" {
+		dir = dir.Parent
+	}
+	currentItem, err := dir.CurrentFile()
+	if err == nil && currentItem.IsDir() && s.enterLastSelected {
+		return ExitCommand{command: "cd", args: []string{path.Join(dir.AbsPath, currentItem.Name())}}
+	}
+	return ExitCommand{command: "cd", args: []string{dir.AbsPath}}
 }
 
 // Print error message to stderr and exit with error code 1
@@ -554,13 +956,61 @@ func fatal(err error) {
 func main() {
 	var err error
 
-	for _, arg := range os.Args {
-		switch arg {
-		case "-h", "--help":
-			fmt.Fprintln(os.Stderr, "itree - A visual file system navigation tool.\n"+
-				"Press h for information on hotkeys.")
-			os.Exit(0)
-		}
+	printMode := flag.Bool("print", false, "Print the tree of the current directory to stdout and exit")
+	depth := flag.Int("depth", 0, "Number of directory levels to print, 0 for no limit")
+	filter := flag.String("filter", "", "Only print files that fuzzy match the filter, and the directories containing them")
+	colorMode := flag.String("color", "auto", "Color the printed tree: auto, always or never")
+	format := flag.String("format", "", "Print the tree in a machine readable format: "+
+		strings.Join(exportFormats, ", ")+". Implies --print")
+	showHidden := flag.Bool("hidden", false, "Show hidden files")
+	sortMode := flag.String("sort", "", "Order to list files in: name, size, mtime, extension or type")
+	sortDesc := flag.Bool("sort-desc", false, "List files in descending order")
+	keymap := flag.String("keymap", "", "Preset of key bindings: default, vim or emacs")
+	configFile := flag.String("config", configPath(), "Path of the config file")
+	printConfig := flag.Bool("default-config", false, "Print the default config file and exit")
+	shellName := flag.String("shell", "posix", "Shell to quote the exit command for: posix, zsh or fish")
+	commandFD := flag.Int("command-fd", 1, "File descriptor to write the exit command to, so that a wrapper "+
+		"only executes the exit command and not output of --print or --default-config")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "itree - A visual file system navigation tool.\n"+
+			"Press CTRL+h for information on hotkeys.\n\nOptions:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *printConfig {
+		data, _ := json.MarshalIndent(defaultConfig(), "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	shell, err := ParseShell(*shellName)
+	if err != nil {
+		fatal(err)
+	}
+
+	// Settings in the config file are overridden by the environment and then the command line
+	config, err := readConfig(*configFile)
+	if err != nil {
+		fatal(err)
+	}
+	if err = config.applyEnv(os.Getenv); err != nil {
+		fatal(err)
+	}
+	if *showHidden {
+		config.ShowHidden = true
+	}
+	if *sortMode != "" {
+		config.Sort = *sortMode
+	}
+	if *sortDesc {
+		config.SortDescending = true
+	}
+	if *keymap != "" {
+		config.Keymap = *keymap
+	}
+	if err = config.validate(); err != nil {
+		fatal(err)
 	}
 
 	cwd, err := os.Getwd()
@@ -572,13 +1022,6 @@ func main() {
 		panic("Cannot get absolute directory.")
 	}
 
-	// Initialize the library that draws to the terminal
-	err = termbox.Init()
-	if err != nil {
-		panic(err)
-	}
-	defer termbox.Close()
-
 	// Set the current directory context
 	var curDir *ctx.Directory
 	curDir, err = ctx.CreateDirectoryChain(cwd)
@@ -589,20 +1032,60 @@ func main() {
 		fatal(err)
 	}
 
-	s := Screen{searchString: make([]rune, 0, 100),
-		commandString:    make([]rune, 0, 100),
-		CurrentDir:       curDir,
-		state:            Directory,
-		captureMode:      modeSearch,
-		showPermissions:  false,
-		maxLevelWidth:    15,
-		highlightedColor: termbox.ColorCyan,
-		filteredColor:    termbox.ColorGreen,
-		directoryColor:   termbox.ColorYellow,
-		fileColor:        termbox.ColorWhite,
+	s := newScreen(curDir, termboxRenderer{}, config)
+
+	if *printMode || *format != "" {
+		opts := printOptions{depth: *depth}
+		switch *colorMode {
+		case "auto":
+			opts.color = isTerminal(os.Stdout)
+		case "always":
+			opts.color = true
+		case "never":
+		default:
+			fatal(fmt.Errorf("invalid color mode %q, expected auto, always or never", *colorMode))
+		}
+		if *filter != "" {
+			opts.match = func(name string) bool { return fuzzy.Match(*filter, name) }
+		}
+		if *format != "" {
+			var root *exportEntry
+			if root, err = exportDirectory(curDir); err == nil {
+				root.Children = exportNodes(curDir.Subtree(opts.depth, opts.match))
+				err = writeExport(os.Stdout, *format, root)
+			}
+		} else {
+			err = s.printTree(os.Stdout, opts)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	// Initialize the library that draws to the terminal
+	err = termbox.Init()
+	if err != nil {
+		panic(err)
 	}
+	defer termbox.Close()
+	termbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
+
+	// Watch the visible directories so that changes made elsewhere show up immediately
+	if watcher, err := ctx.NewWatcher(); err == nil {
+		s.watcher = watcher
+		defer watcher.Close()
+	}
+	s.setOutputMode(termbox.SetOutputMode(outputModeFor(config.ColorMode)))
 	exitCommand := s.Main()
+	exitCommand.shell = shell
 	// Print the command we want to execute in the current shell
 	// The companion shell script will execute this command in the current shell.
-	fmt.Print(exitCommand.FullCommand())
+	out := os.Stdout
+	if *commandFD != 1 {
+		out = os.NewFile(uintptr(*commandFD), "command")
+	}
+	if _, err = fmt.Fprint(out, exitCommand.FullCommand()); err != nil {
+		fatal(err)
+	}
 }
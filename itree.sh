@@ -1,10 +1,14 @@
 #!/bin/bash
 
-source ${HOME}/.config/itree/preferences
+# Preferences from older installations override the config file
+if [ -f "${HOME}/.config/itree/preferences" ]; then
+    source "${HOME}/.config/itree/preferences"
+fi
 
-# Execute itree and capture the resulting command it spits back
-CMD=$(itree2 "$@")
+# Execute itree and capture the resulting command it spits back on file descriptor 3.
+# Anything else it prints, such as the tree of --print, goes to stdout as it is and is never executed.
+# The arguments of the command are quoted for the shell that sourced this script.
+{ CMD=$(itree2 ${ZSH_VERSION:+--shell=zsh} --command-fd=3 "$@" 3>&1 1>&4 4>&-); } 4>&1
 
 # Execute the command it spits back
-eval ${CMD}
-
+eval "${CMD}"
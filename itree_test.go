@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Returns a screen on a temporary directory holding the files a, b and c
+func markScreen(t *testing.T) (*Screen, string) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir, err := ctx.CreateDirectoryChain(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Screen{CurrentDir: dir, marked: make(map[string]bool)}, root
+}
+
+func TestToggleMark(t *testing.T) {
+	s, root := markScreen(t)
+	s.toggleMark()
+	if !s.marked[filepath.Join(root, "a")] {
+		t.Error(fmt.Sprintf("Expected a to be marked, found %v", s.marked))
+	}
+	if f, _ := s.CurrentDir.CurrentFile(); f == nil || f.Name() != "b" {
+		t.Error(fmt.Sprintf("Expected the selector to move on to b, found %v", f))
+	}
+
+	s.CurrentDir.MoveSelector(-1)
+	s.toggleMark()
+	if len(s.marked) != 0 {
+		t.Error(fmt.Sprintf("Expected toggling a marked item to unmark it, found %v", s.marked))
+	}
+}
+
+func TestMarkedPaths(t *testing.T) {
+	s, root := markScreen(t)
+	cases := []struct {
+		toggle   []string // Items to toggle the mark of, in order
+		expected []string
+	}{
+		{nil, []string{}},
+		{[]string{"c", "a"}, []string{"a", "c"}},
+		{[]string{"b", "c", "b", "a", "b"}, []string{"a", "b", "c"}},
+		{[]string{"a", "a", "c"}, []string{"c"}},
+	}
+	for _, c := range cases {
+		s.marked = make(map[string]bool)
+		for _, name := range c.toggle {
+			s.CurrentDir.SelectFile(name)
+			s.toggleMark()
+		}
+		expected := make([]string, len(c.expected))
+		for ii, name := range c.expected {
+			expected[ii] = filepath.Join(root, name)
+		}
+		if paths := s.markedPaths(); !reflect.DeepEqual(paths, expected) {
+			t.Error(fmt.Sprintf("%v: Expected the marked paths %v, found %v", c.toggle, expected, paths))
+		}
+	}
+}
+
+func TestExitCommandArgs(t *testing.T) {
+	s, root := markScreen(t)
+	s.CurrentDir.SelectFile("b")
+	cmd := ExitCommand{command: "ls", args: s.selectedPaths()}
+	if expected := "ls " + filepath.Join(root, "b"); cmd.FullCommand() != expected {
+		t.Error(fmt.Sprintf("Expected the selected item to be passed when none are marked, found %q", cmd.FullCommand()))
+	}
+
+	s.CurrentDir.SelectFile("c")
+	s.toggleMark()
+	s.CurrentDir.SelectFile("a")
+	s.toggleMark()
+	cmd = ExitCommand{command: "ls", args: s.selectedPaths()}
+	if expected := "ls " + filepath.Join(root, "a") + " " + filepath.Join(root, "c"); cmd.FullCommand() != expected {
+		t.Error(fmt.Sprintf("Expected the marked items to be passed instead of the selected one, found %q", cmd.FullCommand()))
+	}
+}
+
+func TestConfirmFilter(t *testing.T) {
+	s, _ := fileOpsScreen(t, "main.go", "notes.txt", "readme")
+	cases := []struct {
+		keys     string
+		filtered bool
+		listed   int // Files that are listed, only the matches once C-o is pressed
+	}{
+		{"/main<Enter>", true, 3},
+		{"<C-o>", true, 1},
+		{"<Esc>", false, 3},
+		{"/note<Esc>", false, 3},
+		{"/n<Enter>/ot<Enter>", true, 1},
+	}
+	for _, c := range cases {
+		press(t, s, c.keys)
+		if s.CurrentDir.Filtered() != c.filtered || s.captureInput {
+			t.Error(fmt.Sprintf("%s: Expected the filter to be kept %v, found %v", c.keys, c.filtered, s.CurrentDir.Filtered()))
+		}
+		if listed := s.CurrentDir.ListedFiles(s.onlyMatches); len(listed) != c.listed {
+			t.Error(fmt.Sprintf("%s: Expected %d files to be listed, found %d", c.keys, c.listed, len(listed)))
+		}
+	}
+}
+
+func TestNothingMatches(t *testing.T) {
+	s, _ := fileOpsScreen(t, "main.go", "notes.txt", "readme")
+	press(t, s, "<C-o>/zzz<Enter>")
+	if listed := s.CurrentDir.ListedFiles(s.onlyMatches); len(listed) != 0 {
+		t.Error(fmt.Sprintf("Expected no files to be listed when nothing matches, found %v", listed))
+	}
+	idx := s.CurrentDir.FileIdx
+	press(t, s, "<Down><Down><End>")
+	if s.CurrentDir.FileIdx != idx {
+		t.Error(fmt.Sprintf("Expected the selector to stay at %d while nothing is listed, found %d", idx, s.CurrentDir.FileIdx))
+	}
+	s.draw()
+	if screen := s.renderer.(*memRenderer).String(); strings.Contains(screen, "main.go") || strings.Contains(screen, "readme") {
+		t.Error(fmt.Sprintf("Expected no files to be drawn, found\n%s", screen))
+	}
+}
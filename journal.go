@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lobocv/itree/ctx"
+	"github.com/lobocv/itree/trash"
+)
+
+// The most entries that the journal keeps, the oldest are forgotten first
+const maxJournalEntries = 100
+
+// The kinds of changes to the file system that are journaled
+const (
+	opMove   = "move"   // Src was moved or renamed to Dst
+	opCopy   = "copy"   // Src was copied to Dst
+	opMkdir  = "mkdir"  // The directory Dst was created, along with the missing directories above it up to Src
+	opCreate = "create" // The empty file Dst was created, along with the missing directories above it up to Src
+	opTrash  = "trash"  // Src was moved to the trash TrashDir, where it is named Dst
+	opChmod  = "chmod"  // The permissions of Dst were changed from OldMode to Mode
+	opChown  = "chown"  // The owner of Dst was changed from OldUID and OldGID to UID and GID
+)
+
+// A change to the file system that can be undone and redone
+type operation struct {
+	Kind     string      `json:"kind"`
+	Src      string      `json:"src,omitempty"`
+	Dst      string      `json:"dst,omitempty"`
+	TrashDir string      `json:"trash_dir,omitempty"`
+	TopDir   string      `json:"top_dir,omitempty"` // Top directory of the file system of TrashDir, if it is not the home trash
+	OldMode  os.FileMode `json:"old_mode,omitempty"`
+	Mode     os.FileMode `json:"mode,omitempty"`
+	OldUID   int         `json:"old_uid,omitempty"`
+	OldGID   int         `json:"old_gid,omitempty"`
+	UID      int         `json:"uid,omitempty"`
+	GID      int         `json:"gid,omitempty"`
+}
+
+// The changes made by one action, which are undone and redone together
+type journalEntry struct {
+	Description string      `json:"description"` // What was done, as it was shown on the status line
+	Time        time.Time   `json:"time"`
+	Operations  []operation `json:"operations"`
+}
+
+// The changes made to the file system, the entries before Position are done and the entries from
+// Position on have been undone and can be redone
+type journal struct {
+	Entries  []journalEntry `json:"entries"`
+	Position int            `json:"position"`
+	path     string         // File the journal is saved to after every change, "" to keep it in memory
+}
+
+// Returns the path of the file that the journal is kept in between sessions
+func journalPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".local", "state")
+	}
+	return filepath.Join(dir, "itree", "journal.json")
+}
+
+// Read the journal saved at path. A missing file is an empty journal.
+func readJournal(path string) (*journal, error) {
+	j := &journal{path: path}
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	} else if err != nil {
+		return j, err
+	}
+	if err := json.Unmarshal(data, j); err != nil {
+		return &journal{path: path}, fmt.Errorf("%s: %v", path, err)
+	}
+	if j.Position < 0 || j.Position > len(j.Entries) {
+		j.Position = len(j.Entries)
+	}
+	return j, nil
+}
+
+// Write the journal to its file, replacing the file at once so that it is never left half written
+func (j *journal) save() error {
+	if j.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// Change the journal with fn and save it. Other sessions may have changed the file since it was read,
+// so it is read again first, and locked until it is saved so that no change of another session is lost.
+// The journal is saved even if fn fails, an error saving it is returned over the error of fn.
+func (j *journal) update(fn func() error) error {
+	if j.path == "" {
+		return fn()
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(j.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockJournal(lock); err != nil {
+		return err
+	}
+	defer unlockJournal(lock)
+
+	latest, err := readJournal(j.path)
+	if err != nil {
+		return err
+	}
+	j.Entries, j.Position = latest.Entries, latest.Position
+	err = fn()
+	if saveErr := j.save(); saveErr != nil {
+		err = saveErr
+	}
+	return err
+}
+
+// Record the changes of an action. The entries that were undone can no longer be redone.
+func (j *journal) record(description string, ops []operation) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	return j.update(func() error {
+		j.Entries = append(j.Entries[:j.Position], journalEntry{Description: description, Time: time.Now(), Operations: ops})
+		if len(j.Entries) > maxJournalEntries {
+			j.Entries = j.Entries[len(j.Entries)-maxJournalEntries:]
+		}
+		j.Position = len(j.Entries)
+		return nil
+	})
+}
+
+// Undo the last entry that is done, its operations are reverted last one first. Returns the entry and the paths
+// that changed. When an operation fails the entry keeps the operations that are still done, the ones that were
+// reverted cannot be redone.
+func (j *journal) undo() (journalEntry, []string, error) {
+	var entry journalEntry
+	var changed []string
+	err := j.update(func() error {
+		if j.Position == 0 {
+			return errors.New("nothing to undo")
+		}
+		entry = j.Entries[j.Position-1]
+		for ii := len(entry.Operations) - 1; ii >= 0; ii-- {
+			op := entry.Operations[ii]
+			if err := op.revert(); err != nil {
+				if ii < len(entry.Operations)-1 {
+					j.Entries[j.Position-1].Operations = entry.Operations[:ii+1]
+					j.Entries = j.Entries[:j.Position]
+				}
+				return err
+			}
+			changed = append(changed, op.Dst, op.Src)
+		}
+		j.Position--
+		return nil
+	})
+	return entry, changed, err
+}
+
+// Redo the first entry that was undone. Returns the entry and the paths that changed. When an operation
+// fails the entry keeps the operations that were redone, the others cannot be redone again.
+func (j *journal) redo() (journalEntry, []string, error) {
+	var entry journalEntry
+	var changed []string
+	err := j.update(func() error {
+		if j.Position == len(j.Entries) {
+			return errors.New("nothing to redo")
+		}
+		entry = j.Entries[j.Position]
+		for ii := range entry.Operations {
+			op := &entry.Operations[ii]
+			if err := op.apply(); err != nil {
+				if ii > 0 {
+					entry.Operations = entry.Operations[:ii]
+					j.Entries = append(j.Entries[:j.Position], entry)
+					j.Position++
+				}
+				return err
+			}
+			changed = append(changed, op.Src, op.Dst)
+		}
+		j.Position++
+		return nil
+	})
+	return entry, changed, err
+}
+
+// Make the change of the operation again
+func (op *operation) apply() error {
+	var err error
+	switch op.Kind {
+	case opMove:
+		err = ctx.MoveTo(op.Src, op.Dst)
+	case opCopy:
+		err = ctx.CopyTo(op.Src, op.Dst)
+	case opMkdir:
+		err = ctx.Mkdir(op.Dst)
+	case opCreate:
+		if _, err = os.Lstat(op.Dst); err == nil {
+			return &os.PathError{Op: "create", Path: op.Dst, Err: os.ErrExist}
+		}
+		err = ctx.Touch(op.Dst)
+	case opTrash:
+		var item trash.Item
+		if item, err = trash.Put(op.Src); err == nil {
+			op.Dst, op.TrashDir, op.TopDir = item.Name, item.Trash.Dir, item.Trash.TopDir
+		}
+	case opChmod:
+		err = os.Chmod(op.Dst, op.Mode)
+	case opChown:
+		err = os.Lchown(op.Dst, op.UID, op.GID)
+	default:
+		err = fmt.Errorf("unknown operation %q", op.Kind)
+	}
+	return err
+}
+
+// Undo the change of the operation
+func (op *operation) revert() error {
+	var err error
+	switch op.Kind {
+	case opMove:
+		err = ctx.MoveTo(op.Dst, op.Src)
+	case opCopy:
+		// The copy may have been changed since, so it is kept in the trash
+		_, err = trash.Put(op.Dst)
+	case opMkdir, opCreate:
+		if info, statErr := os.Lstat(op.Dst); statErr == nil && !info.IsDir() && info.Size() > 0 {
+			return fmt.Errorf("%s has been written to since it was created", op.Dst)
+		}
+		// Only empty directories are removed
+		for p := op.Dst; ; p = filepath.Dir(p) {
+			if err = os.Remove(p); err != nil || p == op.Src || p == filepath.Dir(p) {
+				break
+			}
+		}
+	case opTrash:
+		item := trash.Item{Trash: &trash.Trash{Dir: op.TrashDir, TopDir: op.TopDir}, Name: op.Dst, Path: op.Src}
+		err = item.Restore()
+	case opChmod:
+		err = os.Chmod(op.Dst, op.OldMode)
+	case opChown:
+		err = os.Lchown(op.Dst, op.OldUID, op.OldGID)
+	default:
+		err = fmt.Errorf("unknown operation %q", op.Kind)
+	}
+	return err
+}
+
+// Returns the first of path and the directories above it that does not exist, which is the top
+// directory that is created when path is created
+func firstMissing(path string) string {
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		if _, err := os.Lstat(parent); err == nil {
+			return path
+		}
+		path = parent
+	}
+}
+
+// Record the changes of an action in the journal, errors saving the journal are shown on the status line
+func (s *Screen) journalOperations(description string, ops []operation) {
+	if err := s.journal.record(description, ops); err != nil {
+		s.setError(fmt.Errorf("saving the journal: %v", err))
+	}
+}
+
+// Undo the last change to the file system
+func (s *Screen) undo() {
+	entry, changed, err := s.journal.undo()
+	s.refreshJournaled(changed)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	s.setStatus("Undid: " + entry.Description)
+}
+
+// Redo the last change to the file system that was undone
+func (s *Screen) redo() {
+	entry, changed, err := s.journal.redo()
+	s.refreshJournaled(changed)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	s.setStatus("Redid: " + entry.Description)
+}
+
+// Update the tree after changes were undone or redone, the trash operations name items in the
+// trash rather than paths so those are left out
+func (s *Screen) refreshJournaled(changed []string) {
+	var paths []string
+	for _, p := range changed {
+		if filepath.IsAbs(p) {
+			paths = append(paths, p)
+			s.unmark(p)
+		}
+	}
+	s.refreshItems(paths)
+}
@@ -0,0 +1,15 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import "os"
+
+// Files are not locked on this platform, the journal is still read again before it is changed
+func lockJournal(f *os.File) error {
+	return nil
+}
+
+func unlockJournal(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUndoRedo(t *testing.T) {
+	s, root := fileOpsScreen(t, "a", "b", "dir/")
+	setTrashHome(t, root)
+	exists := func(name string) bool {
+		_, err := os.Lstat(filepath.Join(root, name))
+		return err == nil
+	}
+
+	cases := []struct {
+		keys      string
+		done      []string // Items that exist after the keys, and not after undoing them
+		undone    []string // Items that exist after undoing the keys, and not after the keys
+		selection string   // The item selected after undoing
+	}{
+		{"<Down>r<Backspace>c<Enter>", []string{"c"}, []string{"a"}, "a"},
+		{"nx/y<Enter>", []string{"x/y", "x"}, nil, ""},
+		{"Nfile<Enter>", []string{"file"}, nil, ""},
+		{"<Home><Down>mdir<Enter>", []string{"dir/a"}, []string{"a"}, "a"},
+		{"<Home><Down>Dy", []string{}, []string{"a"}, "a"},
+		{"<Home><Down>Cdir/copy<Enter>", []string{"dir/copy"}, nil, ""},
+	}
+	for _, c := range cases {
+		press(t, s, c.keys)
+		check := func(when string, present, absent []string) {
+			for _, name := range present {
+				if !exists(name) {
+					t.Error(fmt.Sprintf("%s: Expected %s to exist %s", c.keys, name, when))
+				}
+			}
+			for _, name := range absent {
+				if exists(name) {
+					t.Error(fmt.Sprintf("%s: Expected %s not to exist %s", c.keys, name, when))
+				}
+			}
+		}
+		check("after the keys", c.done, c.undone)
+		press(t, s, "u")
+		check("after undoing", c.undone, c.done)
+		if c.selection != "" {
+			if f, _ := s.CurrentDir.CurrentFile(); f == nil || f.Name() != c.selection {
+				t.Error(fmt.Sprintf("%s: Expected %s to be selected after undoing, found %v", c.keys, c.selection, f))
+			}
+		}
+		press(t, s, "<C-r>")
+		check("after redoing", c.done, c.undone)
+		press(t, s, "u")
+	}
+
+	press(t, s, "u")
+	if s.status != "Error: nothing to undo" {
+		t.Error(fmt.Sprintf("Expected nothing to undo, found %q", s.status))
+	}
+}
+
+func TestUndoChmod(t *testing.T) {
+	s, root := fileOpsScreen(t, "a")
+	p := filepath.Join(root, "a")
+	press(t, s, "<C-p>600<Enter>")
+	if info, err := os.Stat(p); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatal(fmt.Sprintf("Expected the permissions to be changed to 600, found %v", info))
+	}
+	press(t, s, "u")
+	if info, _ := os.Stat(p); info.Mode().Perm() != 0644 {
+		t.Error(fmt.Sprintf("Expected the permissions to be changed back to 644, found %s", info.Mode()))
+	}
+}
+
+func TestJournalNotEmptied(t *testing.T) {
+	s, root := fileOpsScreen(t)
+	press(t, s, "Nfile<Enter>")
+	os.WriteFile(filepath.Join(root, "file"), []byte("changed"), 0644)
+	press(t, s, "u")
+	if _, err := os.Stat(filepath.Join(root, "file")); err != nil || s.status == "" {
+		t.Error(fmt.Sprintf("Expected a file that was written to not to be removed, found %v, status %q", err, s.status))
+	}
+}
+
+func TestPersistJournal(t *testing.T) {
+	s, root := fileOpsScreen(t, "a")
+	path := filepath.Join(t.TempDir(), "journal.json")
+	s.journal = &journal{path: path}
+	press(t, s, "r<Backspace>b<Enter>")
+
+	// A later session reads the journal and undoes the rename
+	j, err := readJournal(path)
+	if err != nil || len(j.Entries) != 1 || j.Position != 1 {
+		t.Fatal(fmt.Sprintf("Expected the journal to be saved, found %+v, %v", j, err))
+	}
+	s.journal = j
+	press(t, s, "u")
+	if _, err := os.Stat(filepath.Join(root, "a")); err != nil {
+		t.Error(fmt.Sprintf("Expected the rename to be undone, found %v", err))
+	}
+	if j, _ := readJournal(path); j.Position != 0 || len(j.Entries) != 1 {
+		t.Error(fmt.Sprintf("Expected the undo to be saved, found %+v", j))
+	}
+
+	if j, err := readJournal(filepath.Join(root, "missing.json")); err != nil || len(j.Entries) != 0 {
+		t.Error(fmt.Sprintf("Expected a missing journal to be empty, found %+v, %v", j, err))
+	}
+}
+
+func TestJournalSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	first, _ := readJournal(path)
+	second, _ := readJournal(path)
+	first.record("first", []operation{{Kind: opMkdir, Dst: "/a"}})
+	second.record("second", []operation{{Kind: opMkdir, Dst: "/b"}})
+
+	// Both sessions started with an empty journal, neither loses the entry of the other
+	j, err := readJournal(path)
+	if err != nil || len(j.Entries) != 2 || j.Position != 2 {
+		t.Fatal(fmt.Sprintf("Expected the entries of both sessions to be saved, found %+v, %v", j, err))
+	}
+	if j.Entries[0].Description != "first" || j.Entries[1].Description != "second" {
+		t.Error(fmt.Sprintf("Expected the entries in the order they were recorded, found %+v", j.Entries))
+	}
+}
+
+func TestUndoToExactPaths(t *testing.T) {
+	s, root := fileOpsScreen(t, "a", "dir/")
+	p := func(name string) string { return filepath.Join(root, name) }
+	press(t, s, "<Down>mdir<Enter>")
+
+	// A directory that now has the name the item had is not moved into
+	os.Mkdir(p("a"), 0755)
+	press(t, s, "u")
+	if _, err := os.Lstat(p("a/a")); err == nil || !strings.HasPrefix(s.status, "Error:") {
+		t.Error(fmt.Sprintf("Expected undoing to fail instead of moving into a, found status %q", s.status))
+	}
+	os.Remove(p("a"))
+	press(t, s, "u")
+	if info, err := os.Lstat(p("a")); err != nil || info.IsDir() {
+		t.Fatal(fmt.Sprintf("Expected the move to be undone, found %v", err))
+	}
+
+	os.Mkdir(p("dir/a"), 0755)
+	press(t, s, "<C-r>")
+	if _, err := os.Lstat(p("dir/a/a")); err == nil || !strings.HasPrefix(s.status, "Error:") {
+		t.Error(fmt.Sprintf("Expected redoing to fail instead of moving into dir/a, found status %q", s.status))
+	}
+}
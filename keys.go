@@ -0,0 +1,527 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+// An action that can be bound to a key sequence. run returns the command to exit with,
+// or nil to keep going.
+type action struct {
+	name        string
+	description string
+	run         func(s *Screen) *ExitCommand
+}
+
+// All of the actions that can be bound to keys, in the order they are listed on the help screen
+var actions = []action{
+	{"help", "Show / hide this list of key bindings", func(s *Screen) *ExitCommand {
+		s.toggleHelp()
+		return nil
+	}},
+	{"quit", "Exit and change directory", func(s *Screen) *ExitCommand {
+		if s.state == Help {
+			s.toggleHelp()
+			return nil
+		}
+		cmd := s.cdCommand()
+		return &cmd
+	}},
+	{"quit-no-cd", "Exit without changing directory", func(s *Screen) *ExitCommand {
+		return &ExitCommand{}
+	}},
+	{"move-up", "Move the selector up by one", func(s *Screen) *ExitCommand {
+		s.moveSelector(-1)
+		return nil
+	}},
+	{"move-down", "Move the selector down by one", func(s *Screen) *ExitCommand {
+		s.moveSelector(1)
+		return nil
+	}},
+	{"ascend", "Exit the current directory", func(s *Screen) *ExitCommand {
+		s.exitCurrentDirectory()
+		return nil
+	}},
+	{"descend", "Enter the selected directory", func(s *Screen) *ExitCommand {
+		s.enterCurrentDirectory()
+		return nil
+	}},
+	{"ascend-two", "Jump up two directories", func(s *Screen) *ExitCommand {
+		s.exitCurrentDirectory()
+		s.exitCurrentDirectory()
+		return nil
+	}},
+	{"jump-up", "Move the selector half the distance between the current position and the top of the directory", func(s *Screen) *ExitCommand {
+		s.jumpUp()
+		return nil
+	}},
+	{"jump-down", "Move the selector half the distance between the current position and the bottom of the directory", func(s *Screen) *ExitCommand {
+		s.jumpDown()
+		return nil
+	}},
+	{"go-top", "Move the selector to the first item", func(s *Screen) *ExitCommand {
+		s.moveSelector(-len(s.CurrentDir.Files))
+		return nil
+	}},
+	{"go-bottom", "Move the selector to the last item", func(s *Screen) *ExitCommand {
+		s.moveSelector(len(s.CurrentDir.Files))
+		return nil
+	}},
+	{"toggle-extremities", "Toggle the selector between the first and last item", func(s *Screen) *ExitCommand {
+		s.toggleIndexToExtremities()
+		return nil
+	}},
+	{"toggle-hidden", "Toggle on / off visibility of hidden files", func(s *Screen) *ExitCommand {
+		s.CurrentDir.SetShowHidden(!s.CurrentDir.ShowHidden)
+		return nil
+	}},
+	{"toggle-permissions", "Show file permissions", func(s *Screen) *ExitCommand {
+		s.togglePermissions()
+		return nil
+	}},
+	{"toggle-preview", "Show a preview of the selected item beside the tree", func(s *Screen) *ExitCommand {
+		s.togglePreview()
+		return nil
+	}},
+	{"next-sort-mode", "Cycle the sort order between name, size, modification time, extension and type", func(s *Screen) *ExitCommand {
+		s.setSortMode(s.CurrentDir.SortMode.Next(), s.CurrentDir.SortDesc)
+		return nil
+	}},
+	{"toggle-sort-order", "Toggle between ascending and descending sort order", func(s *Screen) *ExitCommand {
+		s.setSortMode(s.CurrentDir.SortMode, !s.CurrentDir.SortDesc)
+		return nil
+	}},
+	{"toggle-mark", "Mark / unmark the selected item", func(s *Screen) *ExitCommand {
+		s.toggleMark()
+		return nil
+	}},
+	{"filter", "Filter the current directory", func(s *Screen) *ExitCommand {
+		s.setCaptureMode(modeSearch)
+		s.startCapturingInput()
+		return nil
+	}},
+	{"next-match-mode", "Switch between fuzzy, substring, glob and regex matching for the filter", func(s *Screen) *ExitCommand {
+		s.cycleMatchMode()
+		return nil
+	}},
+	{"toggle-only-matches", "Toggle between showing all files and only the files that match the filter", func(s *Screen) *ExitCommand {
+		s.toggleOnlyMatches()
+		return nil
+	}},
+	{"search-below", "Search for files below the current directory, Enter jumps to the selected result", func(s *Screen) *ExitCommand {
+		s.setCaptureMode(modeRecursiveSearch)
+		s.startCapturingInput()
+		return nil
+	}},
+	{"grep", "Search the contents of the files below the current directory, Enter jumps to the selected file", func(s *Screen) *ExitCommand {
+		s.setCaptureMode(modeGrep)
+		s.startCapturingInput()
+		return nil
+	}},
+	{"exit-command", "Enter a command to exit with, which acts on the marked items", func(s *Screen) *ExitCommand {
+		s.setCaptureMode(modeExitCommand)
+		s.startCapturingInput()
+		return nil
+	}},
+	{"chmod", "Change the permissions of the marked items, or the selected item, to an octal or symbolic mode (eg 644, u+x,go-w, -R d:755 f:644)", func(s *Screen) *ExitCommand {
+		s.startPermissionChange(modeFilePerm)
+		return nil
+	}},
+	{"edit-permissions", "Toggle the permissions of the marked items, or the selected item, and preview them before applying", func(s *Screen) *ExitCommand {
+		s.openPermEditor()
+		return nil
+	}},
+	{"chown", "Change the owner and group of the marked items, or the selected item, by name (eg alice, alice:staff, :staff)", func(s *Screen) *ExitCommand {
+		s.startPermissionChange(modeChown)
+		return nil
+	}},
+	{"export", "Export the view to a JSON, YAML or NDJSON file", func(s *Screen) *ExitCommand {
+		s.setCaptureMode(modeExport)
+		s.startCapturingInput()
+		return nil
+	}},
+	{"rename", "Rename the selected item", func(s *Screen) *ExitCommand {
+		s.startFileOperation(modeRename)
+		return nil
+	}},
+	{"bulk-rename", "Rename the marked items, or every item in the current directory, in $EDITOR", func(s *Screen) *ExitCommand {
+		s.startBulkRename()
+		return nil
+	}},
+	{"new-directory", "Create a directory, Tab completes the path", func(s *Screen) *ExitCommand {
+		s.startFileOperation(modeNewDir)
+		return nil
+	}},
+	{"new-file", "Create an empty file, Tab completes the path", func(s *Screen) *ExitCommand {
+		s.startFileOperation(modeNewFile)
+		return nil
+	}},
+	{"copy", "Copy the marked items to a directory, or the selected item into the marked directory", func(s *Screen) *ExitCommand {
+		s.startFileOperation(modeCopy)
+		return nil
+	}},
+	{"move", "Move the marked items to a directory, or the selected item into the marked directory", func(s *Screen) *ExitCommand {
+		s.startFileOperation(modeMove)
+		return nil
+	}},
+	{"delete", "Move the marked items, or the selected item, to the trash after asking to confirm", func(s *Screen) *ExitCommand {
+		s.startFileOperation(modeDelete)
+		return nil
+	}},
+	{"trash", "Show the items in the trash, Enter restores the selected item to where it was deleted from", func(s *Screen) *ExitCommand {
+		s.openTrash()
+		return nil
+	}},
+	{"undo", "Undo the last change to the file system", func(s *Screen) *ExitCommand {
+		s.undo()
+		return nil
+	}},
+	{"redo", "Redo the last change to the file system that was undone", func(s *Screen) *ExitCommand {
+		s.redo()
+		return nil
+	}},
+	{"extract", "Exit and extract the selected item of an archive next to the archive", func(s *Screen) *ExitCommand {
+		command, args, err := s.CurrentDir.ExtractCommand()
+		if err != nil {
+			s.setError(err)
+			return nil
+		}
+		return &ExitCommand{command: command, args: args}
+	}},
+}
+
+// Returns the action with the given name, or nil if there is none
+func findAction(name string) *action {
+	for ii := range actions {
+		if actions[ii].name == name {
+			return &actions[ii]
+		}
+	}
+	return nil
+}
+
+// The key sequences that perform each action in the built-in keymaps. Each binding is a
+// space separated list of key sequences.
+var keymapPresets = map[string]map[string]string{
+	"default": {
+		"help":                "<C-h>",
+		"quit":                "q <Esc>",
+		"quit-no-cd":          "<C-c>",
+		"move-up":             "<Up>",
+		"move-down":           "<Down>",
+		"ascend":              "<Left>",
+		"descend":             "<Right>",
+		"ascend-two":          "a",
+		"jump-up":             "e <PgUp>",
+		"jump-down":           "d <PgDn>",
+		"go-top":              "<Home>",
+		"go-bottom":           "<End>",
+		"toggle-extremities":  "c",
+		"toggle-hidden":       "h",
+		"toggle-permissions":  "p",
+		"toggle-preview":      "v",
+		"next-sort-mode":      "s",
+		"toggle-sort-order":   "S",
+		"toggle-mark":         "<Space>",
+		"filter":              "/",
+		"next-match-mode":     "<C-t>",
+		"toggle-only-matches": "<C-o>",
+		"search-below":        "<C-f>",
+		"grep":                "<C-g>",
+		"exit-command":        ":",
+		"chmod":               "<C-p>",
+		"edit-permissions":    "P",
+		"chown":               "o",
+		"export":              "w",
+		"extract":             "x",
+		"rename":              "r",
+		"new-directory":       "n",
+		"new-file":            "N",
+		"copy":                "C",
+		"move":                "m",
+		"delete":              "D <Delete>",
+		"bulk-rename":         "R",
+		"trash":               "T",
+		"undo":                "u",
+		"redo":                "<C-r>",
+	},
+	"vim": {
+		"help":                "<C-h> ?",
+		"quit":                "q <Esc>",
+		"quit-no-cd":          "<C-c>",
+		"move-up":             "k <Up>",
+		"move-down":           "j <Down>",
+		"ascend":              "h <Left>",
+		"descend":             "l <Right> <Enter>",
+		"ascend-two":          "a",
+		"jump-up":             "<C-u> <PgUp>",
+		"jump-down":           "<C-d> <PgDn>",
+		"go-top":              "gg <Home>",
+		"go-bottom":           "G <End>",
+		"toggle-extremities":  "c",
+		"toggle-hidden":       "gh",
+		"toggle-permissions":  "p",
+		"toggle-preview":      "v",
+		"next-sort-mode":      "s",
+		"toggle-sort-order":   "S",
+		"toggle-mark":         "<Space>",
+		"filter":              "/",
+		"next-match-mode":     "<C-t>",
+		"toggle-only-matches": "<C-o>",
+		"search-below":        "<C-f>",
+		"grep":                "<C-g>",
+		"exit-command":        ":",
+		"chmod":               "<C-p>",
+		"edit-permissions":    "P",
+		"chown":               "o",
+		"export":              "w",
+		"extract":             "x",
+		"rename":              "r",
+		"new-directory":       "n",
+		"new-file":            "N",
+		"copy":                "yy",
+		"move":                "m",
+		"delete":              "dd <Delete>",
+		"bulk-rename":         "R",
+		"trash":               "T",
+		"undo":                "u",
+		"redo":                "<C-r>",
+	},
+	"emacs": {
+		"help":                "<C-h>",
+		"quit":                "q <Esc> <C-x><C-c>",
+		"quit-no-cd":          "<C-c>",
+		"move-up":             "<C-p> <Up>",
+		"move-down":           "<C-n> <Down>",
+		"ascend":              "<C-b> <Left>",
+		"descend":             "<C-f> <Right> <Enter>",
+		"ascend-two":          "a",
+		"jump-up":             "<PgUp>",
+		"jump-down":           "<C-v> <PgDn>",
+		"go-top":              "<C-a> <Home>",
+		"go-bottom":           "<C-e> <End>",
+		"toggle-extremities":  "c",
+		"toggle-hidden":       "h",
+		"toggle-permissions":  "p",
+		"toggle-preview":      "v",
+		"next-sort-mode":      "s",
+		"toggle-sort-order":   "S",
+		"toggle-mark":         "<Space>",
+		"filter":              "/",
+		"next-match-mode":     "<C-t>",
+		"toggle-only-matches": "<C-o>",
+		"search-below":        "<C-s>",
+		"grep":                "<C-x>g",
+		"exit-command":        ":",
+		"chmod":               "<C-x>p",
+		"edit-permissions":    "P",
+		"chown":               "O",
+		"export":              "w",
+		"extract":             "x",
+		"rename":              "R",
+		"new-directory":       "+",
+		"new-file":            "<C-x><C-f>",
+		"copy":                "C",
+		"move":                "M",
+		"delete":              "D <Delete>",
+		"bulk-rename":         "<C-x><C-q>",
+		"trash":               "T",
+		"undo":                "u <C-x>u",
+		"redo":                "<C-r>",
+	},
+}
+
+// Names of the keys that do not type a character, as they are written between < and >.
+// CTRL with a letter is written as C-a to C-z.
+var specialKeys = map[string]termbox.Key{
+	"Up":        termbox.KeyArrowUp,
+	"Down":      termbox.KeyArrowDown,
+	"Left":      termbox.KeyArrowLeft,
+	"Right":     termbox.KeyArrowRight,
+	"PgUp":      termbox.KeyPgup,
+	"PgDn":      termbox.KeyPgdn,
+	"Home":      termbox.KeyHome,
+	"End":       termbox.KeyEnd,
+	"Insert":    termbox.KeyInsert,
+	"Delete":    termbox.KeyDelete,
+	"Enter":     termbox.KeyEnter,
+	"Esc":       termbox.KeyEsc,
+	"Tab":       termbox.KeyTab,
+	"Space":     termbox.KeySpace,
+	"Backspace": termbox.KeyBackspace2,
+	"F1":        termbox.KeyF1,
+	"F2":        termbox.KeyF2,
+	"F3":        termbox.KeyF3,
+	"F4":        termbox.KeyF4,
+	"F5":        termbox.KeyF5,
+	"F6":        termbox.KeyF6,
+	"F7":        termbox.KeyF7,
+	"F8":        termbox.KeyF8,
+	"F9":        termbox.KeyF9,
+	"F10":       termbox.KeyF10,
+	"F11":       termbox.KeyF11,
+	"F12":       termbox.KeyF12,
+}
+
+// Returns the name of a key as it is written in a key sequence, or "" if it has no name
+func keyName(ch rune, key termbox.Key) string {
+	if ch != 0 {
+		return string(ch)
+	}
+	for name, k := range specialKeys {
+		if k == key {
+			return "<" + name + ">"
+		}
+	}
+	if key >= termbox.KeyCtrlA && key <= termbox.KeyCtrlZ {
+		return fmt.Sprintf("<C-%c>", 'a'+rune(key-termbox.KeyCtrlA))
+	}
+	return ""
+}
+
+// Split a key sequence such as "gg" or "<C-x>p" into the names of its keys
+func parseKeySequence(seq string) ([]string, error) {
+	var keys []string
+	for len(seq) > 0 {
+		if end := strings.IndexByte(seq, '>'); seq[0] == '<' && end > 1 {
+			name := seq[1:end]
+			var key termbox.Key
+			if k, ok := specialKeys[name]; ok {
+				key = k
+			} else if len(name) == 3 && strings.HasPrefix(name, "C-") && name[2] >= 'a' && name[2] <= 'z' {
+				key = termbox.KeyCtrlA + termbox.Key(name[2]-'a')
+			} else {
+				return nil, fmt.Errorf("unknown key <%s>", name)
+			}
+			// Some CTRL keys are the same as other keys, such as C-i and Tab
+			keys = append(keys, keyName(0, key))
+			seq = seq[end+1:]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(seq)
+		keys = append(keys, string(r))
+		seq = seq[size:]
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key sequence")
+	}
+	return keys, nil
+}
+
+// Keymap binds key sequences to actions
+type Keymap struct {
+	bindings map[string]string   // Name of the action for each key sequence, with its keys separated by spaces
+	keys     map[string][]string // Key sequences of each action, as they were written
+}
+
+// Create a keymap from a preset, replacing the bindings of the actions in overrides.
+// An override that is an empty string unbinds the action.
+func newKeymap(preset string, overrides map[string]string) (*Keymap, error) {
+	base, ok := keymapPresets[preset]
+	if !ok {
+		names := make([]string, 0, len(keymapPresets))
+		for name := range keymapPresets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("keymap: unknown preset %q, expected one of %s", preset, strings.Join(names, ", "))
+	}
+	for name := range overrides {
+		if findAction(name) == nil {
+			return nil, fmt.Errorf("keys: unknown action %q", name)
+		}
+	}
+
+	km := &Keymap{bindings: make(map[string]string), keys: make(map[string][]string)}
+	for _, a := range actions {
+		binding, overridden := overrides[a.name]
+		if !overridden {
+			binding = base[a.name]
+		}
+		for _, seq := range strings.Fields(binding) {
+			keys, err := parseKeySequence(seq)
+			if err != nil {
+				return nil, fmt.Errorf("keys.%s: %v", a.name, err)
+			}
+			joined := strings.Join(keys, " ")
+			if other, ok := km.bindings[joined]; ok {
+				return nil, fmt.Errorf("keys.%s: %s is already bound to %s", a.name, seq, other)
+			}
+			km.bindings[joined] = a.name
+			km.keys[a.name] = append(km.keys[a.name], seq)
+		}
+	}
+
+	// A sequence that starts with another sequence could never be typed
+	for seq, name := range km.bindings {
+		keys := strings.Split(seq, " ")
+		for ii := 1; ii < len(keys); ii++ {
+			if other, ok := km.bindings[strings.Join(keys[:ii], " ")]; ok {
+				return nil, fmt.Errorf("keys.%s: %s starts with %s, which is bound to %s",
+					name, strings.Join(keys, ""), strings.Join(keys[:ii], ""), other)
+			}
+		}
+	}
+	return km, nil
+}
+
+// Find the action bound to a sequence of keys. prefix is true if the keys are the start of a longer
+// sequence, in which case there is no action yet.
+func (km *Keymap) lookup(keys []string) (name string, prefix bool) {
+	joined := strings.Join(keys, " ")
+	if name, ok := km.bindings[joined]; ok {
+		return name, false
+	}
+	for seq := range km.bindings {
+		if strings.HasPrefix(seq, joined+" ") {
+			return "", true
+		}
+	}
+	return "", false
+}
+
+// Returns the key sequences bound to an action, as they are written in the config
+func (km *Keymap) keysFor(name string) []string {
+	return km.keys[name]
+}
+
+// Handle a key press, running the action it completes. Keys that start a sequence are held until
+// the sequence is complete. Returns the command to exit with, or nil to keep going.
+func (s *Screen) handleKey(key string) *ExitCommand {
+	if key == "" {
+		return nil
+	}
+	s.pendingKeys = append(s.pendingKeys, key)
+	name, prefix := s.keymap.lookup(s.pendingKeys)
+	if prefix {
+		s.setStatus(strings.Join(s.pendingKeys, ""))
+		return nil
+	}
+	abandoned := len(s.pendingKeys) > 1
+	s.pendingKeys = s.pendingKeys[:0]
+	if name == "" {
+		if abandoned {
+			// The key did not continue the sequence, it may start a new one
+			return s.handleKey(key)
+		}
+		return nil
+	}
+	return findAction(name).run(s)
+}
+
+// Returns the lines of the help screen, with the keys bound to each action
+func (s *Screen) helpLines() []string {
+	var lines []string
+	for _, a := range actions {
+		keys := s.keymap.keysFor(a.name)
+		if len(keys) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%-20v -  %s", strings.Join(keys, " "), a.description))
+	}
+	return lines
+}
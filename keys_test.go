@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+func TestParseKeySequence(t *testing.T) {
+	cases := []struct {
+		seq      string
+		expected string
+	}{
+		{"gg", "[g g]"},
+		{"<C-x>p", "[<C-x> p]"},
+		{"<C-i>", "[<Tab>]"},
+		{"<C-m><Space>", "[<Enter> <Space>]"},
+		{"<", "[<]"},
+		{"<>", "[< >]"},
+		{"日", "[日]"},
+	}
+	for _, c := range cases {
+		keys, err := parseKeySequence(c.seq)
+		if err != nil {
+			t.Error(err)
+		} else if fmt.Sprint(keys) != c.expected {
+			t.Error(fmt.Sprintf("Expected %s to parse as %s, found %s", c.seq, c.expected, keys))
+		}
+	}
+	if _, err := parseKeySequence("<C-1>"); err == nil {
+		t.Error("Expected an error for an unknown key")
+	}
+}
+
+func TestKeyName(t *testing.T) {
+	cases := []struct {
+		ch       rune
+		key      termbox.Key
+		expected string
+	}{
+		{'q', 0, "q"},
+		{0, termbox.KeyArrowUp, "<Up>"},
+		{0, termbox.KeyCtrlH, "<C-h>"},
+		{0, termbox.KeyBackspace2, "<Backspace>"},
+		{0, termbox.KeyEnter, "<Enter>"},
+		{0, termbox.KeyCtrlG, "<C-g>"},
+	}
+	for _, c := range cases {
+		if name := keyName(c.ch, c.key); name != c.expected {
+			t.Error(fmt.Sprintf("Expected %s, found %s", c.expected, name))
+		}
+	}
+}
+
+func TestKeymapPresets(t *testing.T) {
+	for preset := range keymapPresets {
+		km, err := newKeymap(preset, nil)
+		if err != nil {
+			t.Error(fmt.Sprintf("%s: %v", preset, err))
+			continue
+		}
+		// Every action can be performed with every preset
+		for _, a := range actions {
+			if len(km.keysFor(a.name)) == 0 {
+				t.Error(fmt.Sprintf("%s: %s is not bound", preset, a.name))
+			}
+		}
+	}
+	for name := range keymapPresets["default"] {
+		if findAction(name) == nil {
+			t.Error(fmt.Sprintf("Unknown action %s in the default keymap", name))
+		}
+	}
+}
+
+func TestKeymapErrors(t *testing.T) {
+	cases := []struct {
+		overrides map[string]string
+		expected  string
+	}{
+		{map[string]string{"fly": "f"}, `unknown action "fly"`},
+		{map[string]string{"quit": "h"}, "h is already bound to quit"},
+		{map[string]string{"go-top": "g", "toggle-hidden": "gh"}, "gh starts with g"},
+	}
+	for _, c := range cases {
+		_, err := newKeymap("default", c.overrides)
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Error(fmt.Sprintf("Expected an error about %q, found %v", c.expected, err))
+		}
+	}
+	// An empty binding unbinds the action so that its key can be reused
+	if _, err := newKeymap("default", map[string]string{"toggle-hidden": "", "quit": "h"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleKeySequences(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/a": &fstest.MapFile{},
+		"dir/b": &fstest.MapFile{},
+		"dir/c": &fstest.MapFile{},
+	}
+	dir, err := ctx.NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	km, err := newKeymap("vim", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Screen{CurrentDir: dir, keymap: km}
+
+	s.handleKey("G")
+	if dir.FileIdx != 2 {
+		t.Error(fmt.Sprintf("Expected G to move to the last item, found %d", dir.FileIdx))
+	}
+	s.handleKey("g")
+	if dir.FileIdx != 2 || s.status != "g" {
+		t.Error("Expected g to wait for the rest of the sequence")
+	}
+	s.handleKey("g")
+	if dir.FileIdx != 0 {
+		t.Error(fmt.Sprintf("Expected gg to move to the first item, found %d", dir.FileIdx))
+	}
+
+	// A key that does not continue the sequence is handled on its own
+	s.handleKey("g")
+	s.handleKey("j")
+	if dir.FileIdx != 1 || len(s.pendingKeys) != 0 {
+		t.Error(fmt.Sprintf("Expected j to move down after an abandoned sequence, found %d", dir.FileIdx))
+	}
+
+	if cmd := s.handleKey("<C-c>"); cmd == nil || cmd.command != "" {
+		t.Error(fmt.Sprintf("Expected to exit without a command, found %v", cmd))
+	}
+	if cmd := s.handleKey("q"); cmd == nil || cmd.command != "cd" {
+		t.Error(fmt.Sprintf("Expected to exit with cd, found %v", cmd))
+	}
+}
+
+func TestQuitFromViews(t *testing.T) {
+	s, _ := fileOpsScreen(t, "file")
+	for _, view := range []overlay{&trashView{}, &renamePreview{}, &permEditor{}} {
+		s.overlay = view
+		if cmd := s.handleEvent(termbox.Event{Type: termbox.EventKey, Key: termbox.KeyCtrlC}); cmd == nil || cmd.command != "" {
+			t.Error(fmt.Sprintf("%T: Expected Ctrl+C to exit without a command, found %v", view, cmd))
+		}
+	}
+}
+
+func TestHelpLines(t *testing.T) {
+	km, err := newKeymap("default", map[string]string{"toggle-hidden": ". <F2>", "extract": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Screen{keymap: km}
+	help := strings.Join(s.helpLines(), "\n")
+	if !strings.Contains(help, ". <F2>") {
+		t.Error("Expected the help to show the configured keys")
+	}
+	if strings.Contains(help, "extract") {
+		t.Error("Expected unbound actions to be left out of the help")
+	}
+}
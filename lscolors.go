@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// LSColors colors files the same way that ls does, by their type and extension
+type LSColors struct {
+	types      map[string]Color // Colors by the two letter code of a file type, such as di for directories
+	extensions []lsExtension    // Colors by file name suffix, in the order they appear
+}
+
+type lsExtension struct {
+	suffix string
+	color  Color
+}
+
+// Parse the value of the LS_COLORS environment variable, a colon separated list of type=SGR entries
+// such as "di=01;34:*.tar=01;31". Only the foreground color and the bold, underline and reverse
+// attributes are used. Entries that cannot be parsed are skipped, like ls does.
+func parseLSColors(value string) *LSColors {
+	l := &LSColors{types: make(map[string]Color)}
+	for _, entry := range strings.Split(value, ":") {
+		eq := strings.LastIndexByte(entry, '=')
+		if eq <= 0 {
+			continue
+		}
+		key, sgr := entry[:eq], entry[eq+1:]
+		color, ok := parseSGR(sgr)
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(key, "*") {
+			l.extensions = append(l.extensions, lsExtension{key[1:], color})
+		} else {
+			l.types[key] = color
+		}
+	}
+	return l
+}
+
+// Parse a list of SGR parameters, such as "01;38;5;208", into a color
+func parseSGR(sgr string) (Color, bool) {
+	var c Color
+	var codes []int
+	for _, s := range strings.Split(sgr, ";") {
+		if s == "" {
+			s = "0"
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return c, false
+		}
+		codes = append(codes, n)
+	}
+	for ii := 0; ii < len(codes); ii++ {
+		switch n := codes[ii]; {
+		case n == 0:
+			c = Color{}
+		case n == 1:
+			c.attrs |= termbox.AttrBold
+		case n == 4:
+			c.attrs |= termbox.AttrUnderline
+		case n == 7:
+			c.attrs |= termbox.AttrReverse
+		case n >= 30 && n <= 37:
+			c.kind, c.index = colorBasic, uint8(n-30)
+		case n >= 90 && n <= 97:
+			c.kind, c.index = colorBasic, uint8(n-90+8)
+		case n == 39:
+			c.kind = colorDefault
+		case n == 38 && ii+2 < len(codes) && codes[ii+1] == 5:
+			c.kind, c.index = color256, uint8(codes[ii+2])
+			ii += 2
+		case n == 38 && ii+4 < len(codes) && codes[ii+1] == 2:
+			c.kind = colorRGB
+			c.r, c.g, c.b = uint8(codes[ii+2]), uint8(codes[ii+3]), uint8(codes[ii+4])
+			ii += 4
+		case n == 48 && ii+1 < len(codes) && codes[ii+1] == 5:
+			// Background colors are not used
+			ii += 2
+		case n == 48 && ii+1 < len(codes) && codes[ii+1] == 2:
+			ii += 4
+		}
+	}
+	return c, true
+}
+
+// Returns the color of a file, and false if LS_COLORS does not color it
+func (l *LSColors) colorOf(f os.FileInfo) (Color, bool) {
+	mode := f.Mode()
+	var key string
+	switch {
+	case mode&os.ModeSymlink != 0:
+		key = "ln"
+	case mode.IsDir():
+		key = "di"
+		if mode&os.ModeSticky != 0 && mode&0002 != 0 {
+			key = "tw"
+		} else if mode&0002 != 0 {
+			key = "ow"
+		} else if mode&os.ModeSticky != 0 {
+			key = "st"
+		}
+	case mode&os.ModeNamedPipe != 0:
+		key = "pi"
+	case mode&os.ModeSocket != 0:
+		key = "so"
+	case mode&os.ModeDevice != 0 && mode&os.ModeCharDevice != 0:
+		key = "cd"
+	case mode&os.ModeDevice != 0:
+		key = "bd"
+	case mode&os.ModeSetuid != 0:
+		key = "su"
+	case mode&os.ModeSetgid != 0:
+		key = "sg"
+	case mode&0111 != 0:
+		key = "ex"
+	}
+	// More specific types fall back to the color of the general type, as they do in ls
+	for _, k := range []string{key, fallbackType(key)} {
+		if c, ok := l.types[k]; ok && k != "" {
+			return c, true
+		}
+	}
+	if mode.IsRegular() {
+		// The last matching suffix wins, so later entries override earlier ones
+		name := f.Name()
+		for ii := len(l.extensions) - 1; ii >= 0; ii-- {
+			if strings.HasSuffix(name, l.extensions[ii].suffix) {
+				return l.extensions[ii].color, true
+			}
+		}
+		if c, ok := l.types["fi"]; ok {
+			return c, true
+		}
+	}
+	return Color{}, false
+}
+
+// Returns the general type of a specific file type, such as di for a sticky directory
+func fallbackType(key string) string {
+	switch key {
+	case "tw", "ow", "st":
+		return "di"
+	}
+	return ""
+}
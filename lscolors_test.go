@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+func TestParseSGR(t *testing.T) {
+	cases := []struct {
+		sgr      string
+		expected Color
+	}{
+		{"01;34", Color{kind: colorBasic, index: 4, attrs: termbox.AttrBold}},
+		{"40;33;01", Color{kind: colorBasic, index: 3, attrs: termbox.AttrBold}},
+		{"38;5;208", Color{kind: color256, index: 208}},
+		{"38;2;255;135;0;4", Color{kind: colorRGB, r: 255, g: 135, attrs: termbox.AttrUnderline}},
+		{"48;5;1;91", Color{kind: colorBasic, index: 9}},
+		{"00", Color{}},
+	}
+	for _, c := range cases {
+		found, ok := parseSGR(c.sgr)
+		if !ok || found != c.expected {
+			t.Error(fmt.Sprintf("Expected %q to parse as %+v, found %+v", c.sgr, c.expected, found))
+		}
+	}
+	if _, ok := parseSGR("01;x"); ok {
+		t.Error("Expected an error for an invalid SGR")
+	}
+}
+
+func TestLSColors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/sub":         &fstest.MapFile{Mode: os.ModeDir | 0755},
+		"dir/shared":      &fstest.MapFile{Mode: os.ModeDir | os.ModeSticky | 0777},
+		"dir/link":        &fstest.MapFile{Mode: os.ModeSymlink | 0777},
+		"dir/run.sh":      &fstest.MapFile{Mode: 0755},
+		"dir/archive.tar": &fstest.MapFile{Mode: 0644},
+		"dir/ARCHIVE.TAR": &fstest.MapFile{Mode: 0644},
+		"dir/notes.txt":   &fstest.MapFile{Mode: 0644},
+		"dir/pipe":        &fstest.MapFile{Mode: os.ModeNamedPipe | 0644},
+		"dir/sock":        &fstest.MapFile{Mode: os.ModeSocket | 0644},
+		"dir/plain":       &fstest.MapFile{Mode: 0644},
+	}
+	dir, err := ctx.NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := parseLSColors("rs=0:di=01;34:ln=01;36:so=01;35:pi=40;33:ex=01;32:invalid:*.tar=01;31:*.TAR=31:*.txt=x")
+	expected := map[string]string{
+		"sub":         "01;34",
+		"shared":      "01;34", // Falls back to di without a tw entry
+		"link":        "01;36",
+		"run.sh":      "01;32",
+		"archive.tar": "01;31",
+		"ARCHIVE.TAR": "31",
+		"pipe":        "33",
+		"sock":        "01;35",
+		"notes.txt":   "",
+		"plain":       "",
+	}
+	for _, f := range dir.Files {
+		c, ok := l.colorOf(f)
+		if expected[f.Name()] == "" {
+			if ok {
+				t.Error(fmt.Sprintf("Expected %s not to be colored, found %+v", f.Name(), c))
+			}
+			continue
+		}
+		want, _ := parseSGR(expected[f.Name()])
+		if !ok || c != want {
+			t.Error(fmt.Sprintf("Expected %s to be %+v, found %+v", f.Name(), want, c))
+		}
+	}
+
+	// Files that LS_COLORS does not color use the theme
+	theme, _ := builtinTheme("default")
+	s := Screen{theme: theme, lsColors: l}
+	s.setOutputMode(termbox.OutputNormal)
+	dir.SelectFile("plain")
+	plain, _ := dir.CurrentFile()
+	if s.colorOf(plain) != termbox.ColorWhite {
+		t.Error("Expected the theme color for a file that is not colored by LS_COLORS")
+	}
+	dir.SelectFile("run.sh")
+	exe, _ := dir.CurrentFile()
+	if s.colorOf(exe) != termbox.ColorGreen|termbox.AttrBold {
+		t.Error("Expected the LS_COLORS color for an executable")
+	}
+}
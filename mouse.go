@@ -0,0 +1,114 @@
+package main
+
+import (
+	"time"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Two clicks on the same item within this time are a double click
+const doubleClickInterval = 400 * time.Millisecond
+
+// Number of items the selector moves for each step of the mouse wheel
+const wheelStep = 3
+
+// The area of the screen where an item of a directory was drawn
+type hitbox struct {
+	x0, x1, y int // The item covers x0 up to, but not including, x1 on row y
+	dir       *ctx.Directory
+	idx       int // Index of the item in the directory
+}
+
+// The last click, to detect double clicks
+type click struct {
+	dir  *ctx.Directory
+	idx  int
+	time time.Time
+}
+
+// Returns the item drawn at a position on the screen. Items drawn later are on top of earlier ones.
+func (s *Screen) itemAt(x, y int) (hitbox, bool) {
+	for ii := len(s.hitboxes) - 1; ii >= 0; ii-- {
+		h := s.hitboxes[ii]
+		if y == h.y && x >= h.x0 && x < h.x1 {
+			return h, true
+		}
+	}
+	return hitbox{}, false
+}
+
+// Returns the directory of the path header that is drawn at column x, which is the current directory
+// or one of its ancestors, or nil if there is no path at x.
+func (s *Screen) ancestorAt(x int) *ctx.Directory {
+	var found *ctx.Directory
+	for dir := s.CurrentDir; dir != nil; dir = dir.Parent {
+		if stringWidth(dir.AbsPath) <= x {
+			break
+		}
+		found = dir
+	}
+	return found
+}
+
+// Make an ancestor of the current directory the current directory
+func (s *Screen) ascendTo(dir *ctx.Directory) {
+	for s.CurrentDir != dir && s.CurrentDir.Parent != nil {
+		prev := s.CurrentDir
+		s.exitCurrentDirectory()
+		if s.CurrentDir == prev {
+			return
+		}
+	}
+}
+
+// Handle a mouse event. Clicking an item selects it, at any level of the tree, and double clicking
+// enters it. Clicking the path header goes to that directory. The wheel moves the selector.
+func (s *Screen) handleMouse(ev termbox.Event) {
+	if s.overlay != nil || s.state != Directory {
+		// The help screen and the views shown in place of the tree hide it, so it is neither clicked
+		// nor scrolled
+		return
+	}
+	switch ev.Key {
+	case termbox.MouseWheelUp:
+		if s.results != nil {
+			s.results.move(-wheelStep)
+		} else {
+			s.moveSelector(-wheelStep)
+		}
+	case termbox.MouseWheelDown:
+		if s.results != nil {
+			s.results.move(wheelStep)
+		} else {
+			s.moveSelector(wheelStep)
+		}
+	case termbox.MouseLeft:
+		if s.results != nil || s.captureInput {
+			return
+		}
+		if ev.MouseY == 0 {
+			if dir := s.ancestorAt(ev.MouseX); dir != nil {
+				s.ascendTo(dir)
+			}
+			return
+		}
+		h, ok := s.itemAt(ev.MouseX, ev.MouseY)
+		if !ok {
+			return
+		}
+		double := s.lastClick.dir == h.dir && s.lastClick.idx == h.idx && time.Since(s.lastClick.time) < doubleClickInterval
+		s.lastClick = click{dir: h.dir, idx: h.idx, time: time.Now()}
+
+		s.ascendTo(h.dir)
+		if s.CurrentDir != h.dir {
+			return
+		}
+		s.CurrentDir.FileIdx = h.idx
+		if double {
+			s.lastClick = click{}
+			s.enterCurrentDirectory()
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Returns a screen in /root/a/b of a small file system
+func mouseScreen(t *testing.T) (*Screen, *ctx.Directory) {
+	fsys := fstest.MapFS{
+		"root/a/b/file": &fstest.MapFile{},
+		"root/c/d":      &fstest.MapFile{},
+	}
+	base, err := ctx.NewDirectoryFS(fsys, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Screen{CurrentDir: base}
+	if err := s.jumpTo(base, "a/b/file"); err != nil {
+		t.Fatal(err)
+	}
+	return s, base
+}
+
+func clickAt(s *Screen, x, y int) {
+	s.handleMouse(termbox.Event{Type: termbox.EventMouse, Key: termbox.MouseLeft, MouseX: x, MouseY: y})
+}
+
+func TestAncestorAt(t *testing.T) {
+	s, _ := mouseScreen(t)
+	cases := []struct {
+		x        int
+		expected string
+	}{
+		{0, "/root"},
+		{4, "/root"},
+		{5, "/root/a"},
+		{8, "/root/a/b"},
+		{9, ""},
+	}
+	for _, c := range cases {
+		var found string
+		if dir := s.ancestorAt(c.x); dir != nil {
+			found = dir.AbsPath
+		}
+		if found != c.expected {
+			t.Error(fmt.Sprintf("Expected %q at column %d, found %q", c.expected, c.x, found))
+		}
+	}
+
+	clickAt(s, 6, 0)
+	if s.CurrentDir.AbsPath != "/root/a" {
+		t.Error(fmt.Sprintf("Expected clicking the header to go to /root/a, found %s", s.CurrentDir.AbsPath))
+	}
+}
+
+func TestClickItems(t *testing.T) {
+	s, base := mouseScreen(t)
+	// The files of /root are a and c, drawn one above the other
+	s.hitboxes = []hitbox{
+		{x0: 0, x1: 2, y: 2, dir: base, idx: 0},
+		{x0: 0, x1: 2, y: 3, dir: base, idx: 1},
+	}
+
+	clickAt(s, 5, 3)
+	if s.CurrentDir.AbsPath != "/root/a/b" {
+		t.Error(fmt.Sprintf("Expected a click next to an item to do nothing, found %s", s.CurrentDir.AbsPath))
+	}
+
+	clickAt(s, 1, 3)
+	if s.CurrentDir != base {
+		t.Fatal(fmt.Sprintf("Expected a click on an upper level to go to /root, found %s", s.CurrentDir.AbsPath))
+	}
+	if f, _ := s.CurrentDir.CurrentFile(); f == nil || f.Name() != "c" {
+		t.Error(fmt.Sprintf("Expected c to be selected, found %v", f))
+	}
+
+	clickAt(s, 1, 3)
+	if s.CurrentDir.AbsPath != "/root/c" {
+		t.Error(fmt.Sprintf("Expected a double click to enter /root/c, found %s", s.CurrentDir.AbsPath))
+	}
+
+	s.handleMouse(termbox.Event{Type: termbox.EventMouse, Key: termbox.MouseWheelDown})
+	s.handleMouse(termbox.Event{Type: termbox.EventMouse, Key: termbox.MouseWheelUp})
+	if s.CurrentDir.FileIdx != 0 {
+		t.Error(fmt.Sprintf("Expected the wheel to move the selector back to 0, found %d", s.CurrentDir.FileIdx))
+	}
+}
+
+func TestMouseIgnoredBehindViews(t *testing.T) {
+	s, base := mouseScreen(t)
+	s.hitboxes = []hitbox{{x0: 0, x1: 2, y: 3, dir: base, idx: 1}}
+	for _, view := range []overlay{&trashView{}, &renamePreview{}, &permEditor{}} {
+		s.overlay = view
+		s.handleMouse(termbox.Event{Type: termbox.EventMouse, Key: termbox.MouseWheelUp})
+		clickAt(s, 1, 3)
+		clickAt(s, 0, 0)
+		if s.CurrentDir.AbsPath != "/root/a/b" || s.CurrentDir.FileIdx != 0 {
+			t.Error(fmt.Sprintf("Expected the mouse to do nothing while a view is shown, found %s", s.CurrentDir.AbsPath))
+		}
+	}
+
+	s, _ = fileOpsScreen(t, "a", "b", "c")
+	s.state = Help
+	s.handleMouse(termbox.Event{Type: termbox.EventMouse, Key: termbox.MouseWheelDown})
+	if s.CurrentDir.FileIdx != 0 {
+		t.Error(fmt.Sprintf("Expected the wheel to do nothing while the help is shown, found %d", s.CurrentDir.FileIdx))
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/nsf/termbox-go"
+)
+
+// A view that is shown in place of the tree, such as the trash. While it is shown it takes every key
+// except the one that exits without changing directory, the keys that it does not use are ignored, and
+// the mouse is ignored.
+type overlay interface {
+	// Draws the view from y0 to the bottom of the screen
+	draw(s *Screen, y0 int)
+	// Handle a key, the view closes itself by setting the overlay of the screen to nil
+	handleKey(s *Screen, ev termbox.Event)
+}
+
+// Returns the index that a key moves to in a list of n items, and true if the key moves in the list
+func listKey(ev termbox.Event, idx, n int) (int, bool) {
+	switch ev.Key {
+	case termbox.KeyArrowUp:
+		idx--
+	case termbox.KeyArrowDown:
+		idx++
+	case termbox.KeyPgup:
+		idx -= 10
+	case termbox.KeyPgdn:
+		idx += 10
+	case termbox.KeyHome:
+		idx = 0
+	case termbox.KeyEnd:
+		idx = n - 1
+	default:
+		return idx, false
+	}
+	return max(0, min(n-1, idx)), true
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Start typing the permissions or the owner of the marked items, or of the selected item
+func (s *Screen) startPermissionChange(mode CaptureMode) {
+	if !s.checkLocal() {
+		return
+	}
+	s.operands = s.selectedPaths()
+	if len(s.operands) == 0 {
+		s.setError(errors.New("no item selected"))
+		return
+	}
+	s.setCaptureMode(mode)
+	s.startCapturingInput()
+}
+
+// Returns the prompt to type permissions or an owner, and a preview of the permissions of the first
+// item after the change in the color it is shown in
+func (s *Screen) permissionPrompt() (string, string, termbox.Attribute) {
+	input := string(s.commandString)
+	if len(s.operands) == 0 || (s.captureMode != modeFilePerm && s.captureMode != modeChown) {
+		return "", "", 0
+	}
+	if s.captureMode == modeChown {
+		return fmt.Sprintf("Change the owner of %s to ([-R] USER, USER:GROUP or :GROUP):  %s", describeItems(s.operands), input), "", 0
+	}
+	info, err := os.Stat(s.operands[0])
+	if err != nil {
+		return "", "", 0
+	}
+	old := info.Mode() & ctx.PermBits
+	prompt := fmt.Sprintf("Change the permissions of %s (%s) to:  %s", describeItems(s.operands), ctx.FormatMode(old), input)
+	if strings.TrimSpace(input) == "" {
+		return prompt, "", 0
+	}
+	change, err := ctx.ParseModeChange(input)
+	var mode os.FileMode
+	if err == nil {
+		mode, err = change.Apply(old, info.IsDir())
+	}
+	if err != nil {
+		return prompt, err.Error(), termbox.ColorRed
+	}
+	return prompt, fmt.Sprintf("-> %s (%04o)", ctx.FormatMode(mode), ctx.UnixMode(mode)), termbox.ColorBlue
+}
+
+// Change the permissions or the owner of the items to the input that was typed
+func (s *Screen) runPermissionChange() {
+	input := strings.TrimSpace(string(s.commandString))
+	if input == "" {
+		return
+	}
+	if s.captureMode == modeFilePerm {
+		change, err := ctx.ParseModeChange(input)
+		if err != nil {
+			s.setError(err)
+			return
+		}
+		s.changePermissions(s.operands, change)
+		return
+	}
+
+	recursive := false
+	if fields := strings.Fields(input); len(fields) == 2 && fields[0] == "-R" {
+		recursive, input = true, fields[1]
+	}
+	owner, err := ctx.ParseOwner(input)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	updates, err := ctx.PlanChown(s.operands, owner, recursive)
+	if err == nil {
+		updates, err = ctx.ApplyChown(updates)
+	}
+	var changed []string
+	var ops []operation
+	for _, u := range updates {
+		changed = append(changed, u.Path)
+		ops = append(ops, operation{Kind: opChown, Dst: u.Path, OldUID: u.Old.UID, OldGID: u.Old.GID, UID: u.New.UID, GID: u.New.GID})
+	}
+	s.refreshItems(changed)
+	done := fmt.Sprintf("Changed the owner of %s to %s", describeItems(changed), input)
+	if err != nil {
+		s.setError(err)
+	} else if len(updates) == 0 {
+		s.setStatus("The owner is unchanged")
+	} else {
+		s.setStatus(done)
+	}
+	s.journalOperations(done, ops)
+}
+
+// Change the permissions of the items, and of the items inside of them if the change is recursive
+func (s *Screen) changePermissions(paths []string, change ctx.ModeChange) {
+	updates, err := ctx.PlanChmod(paths, change)
+	if err == nil {
+		updates, err = ctx.ApplyChmod(updates)
+	}
+	var changed []string
+	var ops []operation
+	for _, u := range updates {
+		changed = append(changed, u.Path)
+		ops = append(ops, operation{Kind: opChmod, Dst: u.Path, OldMode: u.Old, Mode: u.New})
+	}
+	s.refreshItems(changed)
+	done := fmt.Sprintf("Changed the permissions of %s", describeItems(changed))
+	if err != nil {
+		s.setError(err)
+	} else if len(updates) == 0 {
+		s.setStatus("The permissions are unchanged")
+	} else {
+		s.setStatus(done)
+	}
+	s.journalOperations(done, ops)
+}
+
+// Which items the permission editor changes
+type permTarget int
+
+const (
+	targetAll permTarget = iota
+	targetDirs
+	targetFiles
+)
+
+func (t permTarget) String() string {
+	return [...]string{"directories and files", "directories", "files"}[t]
+}
+
+// The rows of the permission editor and the bits of their columns: read, write, execute and the special bit
+var permRows = []struct {
+	name    string
+	bits    [4]uint32
+	special string
+}{
+	{"user", [4]uint32{0400, 0200, 0100, 04000}, "setuid"},
+	{"group", [4]uint32{040, 020, 010, 02000}, "setgid"},
+	{"other", [4]uint32{04, 02, 01, 01000}, "sticky"},
+}
+
+// An editor of the permissions of the marked items, or of the selected item, shown in place of the tree.
+// The bits that are toggled are added to or removed from every item, the others are left as they are.
+type permEditor struct {
+	paths     []string
+	base      os.FileMode // Permissions of the first item
+	set       uint32      // Bits that are added, as chmod writes them
+	cleared   uint32      // Bits that are removed
+	row, col  int         // The bit under the cursor
+	recursive bool
+	target    permTarget
+	summary   string // How many items the change affects, empty until it is planned again
+}
+
+// Show the permission editor for the marked items, or the selected item
+func (s *Screen) openPermEditor() {
+	if !s.checkLocal() {
+		return
+	}
+	paths := s.selectedPaths()
+	if len(paths) == 0 {
+		s.setError(errors.New("no item selected"))
+		return
+	}
+	info, err := os.Stat(paths[0])
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	s.overlay = &permEditor{paths: paths, base: info.Mode() & ctx.PermBits}
+}
+
+// Returns the bits of the first item after the change
+func (e *permEditor) bits() uint32 {
+	return ctx.UnixMode(e.base)&^e.cleared | e.set
+}
+
+// Toggle the bit under the cursor
+func (e *permEditor) toggle() {
+	bit := permRows[e.row].bits[e.col]
+	switch {
+	case e.set&bit != 0:
+		e.set &^= bit
+	case e.cleared&bit != 0:
+		e.cleared &^= bit
+	case e.bits()&bit != 0:
+		e.cleared |= bit
+	default:
+		e.set |= bit
+	}
+}
+
+// Returns the symbolic mode that makes the change, such as u+x,go-w
+func (e *permEditor) expression() string {
+	letters := []string{"r", "w", "x", "s"}
+	var clauses []string
+	for ii, row := range permRows {
+		var add, remove string
+		for col, bit := range row.bits {
+			letter := letters[col]
+			if col == 3 && ii == 2 {
+				letter = "t"
+			}
+			if e.set&bit != 0 {
+				add += letter
+			}
+			if e.cleared&bit != 0 {
+				remove += letter
+			}
+		}
+		who := row.name[:1]
+		if add != "" {
+			clauses = append(clauses, who+"+"+add)
+		}
+		if remove != "" {
+			clauses = append(clauses, who+"-"+remove)
+		}
+	}
+	return strings.Join(clauses, ",")
+}
+
+// Returns the change of the permissions that the editor makes
+func (e *permEditor) change() ctx.ModeChange {
+	c := ctx.ModeChange{Recursive: e.recursive}
+	expr := e.expression()
+	if e.target != targetFiles {
+		c.Dirs = expr
+	}
+	if e.target != targetDirs {
+		c.Files = expr
+	}
+	return c
+}
+
+// Draws the permission editor
+func (e *permEditor) draw(s *Screen, y0 int) {
+	white := termbox.ColorWhite
+	s.Print(0, y0, white, termbox.ColorDefault, fmt.Sprintf("Permissions of %s", describeItems(e.paths)))
+	s.Print(10, y0+2, white, termbox.ColorDefault, "read  write  execute  special")
+	columns := []int{11, 17, 24, 33}
+	bits := e.bits()
+	for ii, row := range permRows {
+		y := y0 + 3 + ii
+		s.Print(2, y, white, termbox.ColorDefault, row.name)
+		for col, bit := range row.bits {
+			box := "[ ]"
+			if bits&bit != 0 {
+				box = "[x]"
+			}
+			color := s.fileColor
+			if (e.set|e.cleared)&bit != 0 {
+				color = s.markedColor
+			}
+			if ii == e.row && col == e.col {
+				color = s.highlightedColor
+			}
+			s.Print(columns[col], y, color, termbox.ColorDefault, box)
+		}
+		s.Print(columns[3]+4, y, white, termbox.ColorDefault, row.special)
+	}
+
+	after := ctx.FromUnixMode(bits)
+	s.Print(2, y0+7, white, termbox.ColorDefault, fmt.Sprintf("%s (%04o)  ->  %s (%04o)  %s",
+		ctx.FormatMode(e.base), ctx.UnixMode(e.base), ctx.FormatMode(after), ctx.UnixMode(after), e.expression()))
+	recursive := "[ ]"
+	if e.recursive {
+		recursive = "[x]"
+	}
+	s.Print(2, y0+8, white, termbox.ColorDefault, fmt.Sprintf("%s Recursive (r)    Apply to %s (Tab)", recursive, e.target))
+
+	s.Print(2, y0+10, white, termbox.ColorDefault, e.plan()+". Space toggles, Enter applies, Esc cancels")
+}
+
+// Returns how many items the change affects. The change is planned again only after it changes, since a
+// recursive change walks every item below the directories.
+func (e *permEditor) plan() string {
+	if e.summary != "" {
+		return e.summary
+	}
+	e.summary = "Nothing changes"
+	if e.expression() != "" {
+		updates, err := ctx.PlanChmod(e.paths, e.change())
+		if err != nil {
+			e.summary = "Error: " + err.Error()
+		} else {
+			e.summary = fmt.Sprintf("%d items change", len(updates))
+		}
+	}
+	return e.summary
+}
+
+// Handle a key while the permission editor is shown
+func (e *permEditor) handleKey(s *Screen, ev termbox.Event) {
+	switch {
+	case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+		e.row = max(0, e.row-1)
+	case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+		e.row = min(len(permRows)-1, e.row+1)
+	case ev.Key == termbox.KeyArrowLeft || ev.Ch == 'h':
+		e.col = max(0, e.col-1)
+	case ev.Key == termbox.KeyArrowRight || ev.Ch == 'l':
+		e.col = min(3, e.col+1)
+	case ev.Key == termbox.KeySpace || ev.Ch == 'x':
+		e.toggle()
+		e.summary = ""
+	case ev.Ch == 'r':
+		e.recursive = !e.recursive
+		e.summary = ""
+	case ev.Key == termbox.KeyTab:
+		e.target = (e.target + 1) % 3
+		e.summary = ""
+	case ev.Key == termbox.KeyEnter:
+		s.overlay = nil
+		if e.expression() != "" {
+			s.changePermissions(e.paths, e.change())
+		}
+	case ev.Key == termbox.KeyEsc || ev.Ch == 'q':
+		s.overlay = nil
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChmodSymbolic(t *testing.T) {
+	s, root := fileOpsScreen(t, "dir/", "dir/a", "file")
+	mode := func(name string) os.FileMode {
+		info, _ := os.Stat(filepath.Join(root, name))
+		return info.Mode().Perm()
+	}
+
+	// The permissions of the selected item in the current directory change, not those of a path
+	// relative to the working directory
+	press(t, s, "<Down><C-p>u+x,go-r")
+	if _, preview, _ := s.permissionPrompt(); preview != "-> rwx------ (0700)" {
+		t.Error(fmt.Sprintf("Expected a preview of the permissions, found %q", preview))
+	}
+	press(t, s, "<Enter>")
+	if mode("file") != 0700 || s.status != "Changed the permissions of file" {
+		t.Error(fmt.Sprintf("Expected file to be changed to 700, found %o, status %q", mode("file"), s.status))
+	}
+
+	press(t, s, "<C-p>u+q")
+	if _, preview, _ := s.permissionPrompt(); !strings.Contains(preview, "unknown permission") {
+		t.Error(fmt.Sprintf("Expected the error to be previewed, found %q", preview))
+	}
+	press(t, s, "<Esc>")
+
+	press(t, s, "<Home><C-p>-R d:700 f:600<Enter>")
+	if mode("dir") != 0700 || mode("dir/a") != 0600 {
+		t.Error(fmt.Sprintf("Expected dir to be 700 and dir/a 600, found %o and %o", mode("dir"), mode("dir/a")))
+	}
+	press(t, s, "u")
+	if mode("dir") != 0755 || mode("dir/a") != 0644 {
+		t.Error(fmt.Sprintf("Expected the recursive change to be undone, found %o and %o", mode("dir"), mode("dir/a")))
+	}
+}
+
+func TestPermEditor(t *testing.T) {
+	s, root := fileOpsScreen(t, "file")
+	p := filepath.Join(root, "file")
+
+	// Toggle the user's execute bit and the group's read bit
+	press(t, s, "P<Right><Right><Space><Down><Left><Left><Space>")
+	if e, ok := s.overlay.(*permEditor); !ok || e.expression() != "u+x,g-r" {
+		t.Error(fmt.Sprintf("Expected u+x,g-r, found %+v", s.overlay))
+	}
+	s.draw()
+	screen := s.renderer.(*memRenderer).String()
+	if !strings.Contains(screen, "rw-r--r-- (0644)  ->  rwx---r-- (0704)") || !strings.Contains(screen, "1 items change") {
+		t.Error(fmt.Sprintf("Expected a preview of the change, found\n%s", screen))
+	}
+	if info, _ := os.Stat(p); info.Mode().Perm() != 0644 {
+		t.Error("Expected nothing to change before the change is applied")
+	}
+
+	// Moving the cursor keeps the plan, changing what is applied plans again
+	e := s.overlay.(*permEditor)
+	press(t, s, "<Up>")
+	if e.summary != "1 items change" {
+		t.Error(fmt.Sprintf("Expected the plan to be kept while the cursor moves, found %q", e.summary))
+	}
+	press(t, s, "<Tab>")
+	if e.summary != "" || e.plan() != "0 items change" {
+		t.Error(fmt.Sprintf("Expected nothing to change in directories only, found %q", e.plan()))
+	}
+	press(t, s, "<Tab><Tab><Enter>")
+	if info, _ := os.Stat(p); info.Mode().Perm() != 0704 || s.overlay != nil {
+		t.Error(fmt.Sprintf("Expected the permissions to be 704, found %s", info.Mode()))
+	}
+
+	press(t, s, "P<Space><Esc>")
+	if info, _ := os.Stat(p); info.Mode().Perm() != 0704 || s.overlay != nil {
+		t.Error(fmt.Sprintf("Expected Esc to cancel, found %s", info.Mode()))
+	}
+}
+
+func TestChownUnchanged(t *testing.T) {
+	s, _ := fileOpsScreen(t, "file")
+	press(t, s, fmt.Sprintf("o-R %d:%d<Enter>", os.Getuid(), os.Getgid()))
+	if s.status != "The owner is unchanged" {
+		t.Error(fmt.Sprintf("Expected the owner to stay the same, found %q", s.status))
+	}
+	press(t, s, "o:no-such-group-itree<Enter>")
+	if !strings.HasPrefix(s.status, "Error:") {
+		t.Error(fmt.Sprintf("Expected an error for an unknown group, found %q", s.status))
+	}
+}
+
+func TestPromptsWithoutPermissionPreview(t *testing.T) {
+	s, _ := fileOpsScreen(t, "ab1", "ab2", "file")
+	cases := []struct {
+		keys     string
+		expected string // Shown on the prompt line instead of a preview of permissions
+	}{
+		// Names that look like a mode are not previewed as one
+		{"<End>r<C-u>u+x", ""},
+		{"<End>r<Backspace><Backspace><Backspace><Backspace>700", ""},
+		{"<End>Ca<Tab>", "ab1"},
+	}
+	for _, c := range cases {
+		press(t, s, c.keys)
+		s.draw()
+		line := strings.SplitN(s.renderer.(*memRenderer).String(), "\n", 3)[1]
+		if _, preview, _ := s.permissionPrompt(); preview != "" || !strings.Contains(line, c.expected) || strings.Contains(line, "->") {
+			t.Error(fmt.Sprintf("%s: Expected no preview of permissions, found %q", c.keys, line))
+		}
+		press(t, s, "<Esc>")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Number of bytes of a file that are read to preview it
+const previewBytes = 16 * 1024
+
+// The lines of the preview of an item, kept so that redraws do not read the item again
+type previewCache struct {
+	path          string
+	size          int64
+	modTime       time.Time
+	width, height int
+	lines         []string
+}
+
+// Returns the width of the preview pane for the width of the screen, or 0 if it is hidden
+func (s *Screen) previewWidth(screenWidth int) int {
+	if !s.showPreview {
+		return 0
+	}
+	return max(20, screenWidth/3)
+}
+
+// Draws the preview of the selected item in a pane on the right hand side of the screen
+func (s *Screen) drawPreview(x0, y0, width, height int) {
+	// Clear anything from the tree that overflowed into the pane
+	for y := y0; y < y0+height; y++ {
+		s.renderer.SetCell(x0, y, '│', termbox.ColorWhite, termbox.ColorDefault)
+		for x := x0 + 1; x < x0+width; x++ {
+			s.renderer.SetCell(x, y, ' ', termbox.ColorDefault, termbox.ColorDefault)
+		}
+	}
+	f, err := s.CurrentDir.CurrentFile()
+	if err != nil {
+		return
+	}
+	// Items inside of archives are decompressed to preview them, so the preview is only read again
+	// when another item is selected, the item changes or the pane is resized
+	c := previewCache{
+		path:    path.Join(s.CurrentDir.AbsPath, f.Name()),
+		size:    f.Size(),
+		modTime: f.ModTime(),
+		width:   width,
+		height:  height,
+	}
+	if p := s.preview; p.path != c.path || p.size != c.size || !p.modTime.Equal(c.modTime) || p.width != c.width || p.height != c.height {
+		c.lines = previewLines(s.CurrentDir, f, width-2, height)
+		s.preview = c
+	}
+	lines := s.preview.lines
+	for ii, line := range lines {
+		color := termbox.ColorWhite
+		if ii == 0 {
+			color = termbox.ColorYellow
+		}
+		s.Print(x0+2, y0+ii, color, termbox.ColorDefault, truncate(line, width-2))
+	}
+}
+
+// Returns the lines that preview a file in a directory. The first line describes the file.
+func previewLines(dir *ctx.Directory, f os.FileInfo, width, height int) []string {
+	lines := []string{fmt.Sprintf("%s  %d bytes  %s", f.Mode(), f.Size(), f.ModTime().Format("2006-01-02 15:04"))}
+
+	switch {
+	case f.Mode()&os.ModeSymlink != 0:
+		target, err := dir.Readlink(f.Name())
+		if err != nil {
+			return append(lines, fmt.Sprintf("Error: %v", err))
+		}
+		lines = append(lines, "→ "+target)
+	case f.IsDir():
+		entries, err := dir.ReadDir(f.Name())
+		if err != nil {
+			return append(lines, fmt.Sprintf("Error: %v", err))
+		}
+		var dirs int
+		for _, e := range entries {
+			if e.IsDir() {
+				dirs++
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%d items: %d directories, %d files", len(entries), dirs, len(entries)-dirs), "")
+		for _, e := range entries {
+			if len(lines) >= height {
+				break
+			}
+			name := e.Name()
+			if e.IsDir() {
+				name += "/"
+			}
+			lines = append(lines, name)
+		}
+	case f.Mode().IsRegular():
+		file, err := dir.Open(f.Name())
+		if err != nil {
+			return append(lines, fmt.Sprintf("Error: %v", err))
+		}
+		defer file.Close()
+		contents, err := io.ReadAll(io.LimitReader(file, previewBytes))
+		if err != nil {
+			return append(lines, fmt.Sprintf("Error: %v", err))
+		}
+		lines = append(lines, "")
+		if isBinary(contents) {
+			lines = append(lines, hexDump(contents, width, height-len(lines))...)
+		} else {
+			lines = append(lines, textLines(contents, height-len(lines))...)
+		}
+	}
+	return lines
+}
+
+// Returns true if the contents are not text, judged by the presence of NUL bytes or invalid UTF-8
+func isBinary(contents []byte) bool {
+	if bytes.IndexByte(contents, 0) >= 0 {
+		return true
+	}
+	// The preview may have cut the last character in half
+	for ii := 0; ii < utf8.UTFMax && len(contents) > 0 && !utf8.Valid(contents); ii++ {
+		contents = contents[:len(contents)-1]
+	}
+	return !utf8.Valid(contents)
+}
+
+// Split text into at most n lines, expanding tabs and replacing control characters
+func textLines(contents []byte, n int) []string {
+	var lines []string
+	for _, line := range strings.SplitN(string(contents), "\n", n+1) {
+		if len(lines) == n {
+			break
+		}
+		line = strings.Replace(strings.TrimRight(line, "\r"), "\t", "    ", -1)
+		lines = append(lines, printable(line))
+	}
+	return lines
+}
+
+// Format at most n rows of a hex dump, with as many bytes per row as fit in the width
+func hexDump(contents []byte, width, n int) []string {
+	// Each byte takes 3 columns as hex and 1 column as text, plus the offset and spacing
+	perRow := max(1, (width-11)/4)
+	var lines []string
+	for offset := 0; offset < len(contents) && len(lines) < n; offset += perRow {
+		row := contents[offset:min(offset+perRow, len(contents))]
+		line := strings.Builder{}
+		fmt.Fprintf(&line, "%08x ", offset)
+		for ii := 0; ii < perRow; ii++ {
+			if ii < len(row) {
+				fmt.Fprintf(&line, " %02x", row[ii])
+			} else {
+				line.WriteString("   ")
+			}
+		}
+		line.WriteString("  ")
+		for _, c := range row {
+			if c >= 0x20 && c < 0x7f {
+				line.WriteByte(c)
+			} else {
+				line.WriteByte('.')
+			}
+		}
+		lines = append(lines, line.String())
+	}
+	return lines
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+func TestIsBinary(t *testing.T) {
+	cases := []struct {
+		contents string
+		expected bool
+	}{
+		{"plain text\n", false},
+		{"日本語", false},
+		{"日本語"[:4], false}, // Cut in the middle of a character
+		{"\x00\x01\x02", true},
+		{"\xff\xfe\xfd\xfc\xfb", true},
+	}
+	for _, c := range cases {
+		if found := isBinary([]byte(c.contents)); found != c.expected {
+			t.Error(fmt.Sprintf("Expected isBinary(%q) to be %v", c.contents, c.expected))
+		}
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	lines := hexDump([]byte("abcdefgh\x00\x01"), 11+4*4, 10)
+	expected := []string{
+		"00000000  61 62 63 64  abcd",
+		"00000004  65 66 67 68  efgh",
+		"00000008  00 01        ..",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Error(fmt.Sprintf("Expected:\n%s\nFound:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n")))
+	}
+	if lines = hexDump(make([]byte, 100), 27, 2); len(lines) != 2 {
+		t.Error(fmt.Sprintf("Expected 2 lines, found %d", len(lines)))
+	}
+}
+
+func TestPreviewLines(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/text":      &fstest.MapFile{Data: []byte("line 1\n\tline 2\r\nline 3\nline 4\n")},
+		"dir/sub/a":     &fstest.MapFile{},
+		"dir/sub/inner": &fstest.MapFile{Mode: 0755 | 1<<31},
+	}
+	dir, err := ctx.NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir.SelectFile("text")
+	f, _ := dir.CurrentFile()
+	lines := previewLines(dir, f, 40, 4)
+	if expected := "[ line 1     line 2]"; fmt.Sprint(lines[1:]) != expected {
+		t.Error(fmt.Sprintf("Expected %s, found %s", expected, lines[1:]))
+	}
+
+	dir.SelectFile("sub")
+	f, _ = dir.CurrentFile()
+	lines = previewLines(dir, f, 40, 10)
+	if expected := "[2 items: 1 directories, 1 files  a inner/]"; fmt.Sprint(lines[1:]) != expected {
+		t.Error(fmt.Sprintf("Expected %s, found %s", expected, lines[1:]))
+	}
+}
+
+// A file system that counts the files that are opened
+type countingFS struct {
+	fstest.MapFS
+	opens map[string]int
+}
+
+func (c countingFS) Open(name string) (fs.File, error) {
+	c.opens[name]++
+	return c.MapFS.Open(name)
+}
+
+func TestPreviewCached(t *testing.T) {
+	fsys := countingFS{fstest.MapFS{
+		"dir/a": &fstest.MapFile{Data: []byte("a")},
+		"dir/b": &fstest.MapFile{Data: []byte("b")},
+	}, make(map[string]int)}
+	dir, err := ctx.NewDirectoryFS(fsys, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := defaultConfig()
+	config.LSColors = false
+	s := newScreen(dir, newMemRenderer(80, 20), config)
+	s.showPreview = true
+
+	s.draw()
+	s.draw()
+	if fsys.opens["dir/a"] != 1 {
+		t.Error(fmt.Sprintf("Expected the selected file to be read once for the preview, found %d", fsys.opens["dir/a"]))
+	}
+	dir.SelectFile("b")
+	s.draw()
+	dir.SelectFile("a")
+	s.draw()
+	if fsys.opens["dir/a"] != 2 || fsys.opens["dir/b"] != 1 {
+		t.Error(fmt.Sprintf("Expected the preview to be read again when another file is selected, found %v", fsys.opens))
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Options for printing the tree non-interactively
+type printOptions struct {
+	depth int                    // Number of directory levels to print, 0 for no limit
+	color bool                   // Color the output with ANSI escape sequences
+	match func(name string) bool // Only print files that match, nil to print all files
+}
+
+// Returns true if the file is connected to a terminal rather than a pipe or a file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Wraps the text in the ANSI escape sequences that display it with a termbox color and attributes
+func ansiColor(attr termbox.Attribute, text string) string {
+	var codes []string
+	switch color := attr & 0x1ff; {
+	case color >= termbox.ColorBlack && color <= termbox.ColorWhite:
+		codes = append(codes, fmt.Sprint(30+color-termbox.ColorBlack))
+	case color >= termbox.ColorDarkGray && color <= termbox.ColorLightGray:
+		codes = append(codes, fmt.Sprint(90+color-termbox.ColorDarkGray))
+	}
+	if attr&termbox.AttrBold != 0 {
+		codes = append(codes, "1")
+	}
+	if attr&termbox.AttrUnderline != 0 {
+		codes = append(codes, "4")
+	}
+	if len(codes) == 0 {
+		return text
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m" + text + "\x1b[0m"
+}
+
+// Prints the tree of the current directory to w in the same style as it is drawn on the screen
+func (s *Screen) printTree(w io.Writer, opts printOptions) error {
+	out := bufio.NewWriter(w)
+	root := s.CurrentDir.AbsPath
+	if opts.color {
+		root = ansiColor(termbox.ColorRed, root)
+	}
+	fmt.Fprintln(out, root)
+	s.printNodes(out, s.CurrentDir.Subtree(opts.depth, opts.match), "", opts)
+	return out.Flush()
+}
+
+// Recursively prints the nodes of the tree, prefix is the vertical lines of the parent levels
+func (s *Screen) printNodes(w io.Writer, nodes []*ctx.Node, prefix string, opts printOptions) {
+	for ii, n := range nodes {
+		label := n.Info.Name() + itemSuffix(n.Info)
+		if opts.color {
+			var color termbox.Attribute
+			if opts.match != nil && opts.match(n.Info.Name()) {
+				color = s.filteredColor
+			} else {
+				color = s.colorOf(n.Info)
+			}
+			label = ansiColor(color, label)
+		}
+		if n.Err != nil {
+			label += fmt.Sprintf(" [%v]", n.Err)
+		}
+		fmt.Fprintf(w, "%s%s%s\n", prefix, itemConnector(ii, len(nodes)), label)
+
+		if ii == len(nodes)-1 {
+			s.printNodes(w, n.Children, prefix+"  ", opts)
+		} else {
+			s.printNodes(w, n.Children, prefix+"│ ", opts)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+var printFS = fstest.MapFS{
+	"root/a/b/x": &fstest.MapFile{},
+	"root/a/y":   &fstest.MapFile{},
+	"root/c/z":   &fstest.MapFile{},
+	"root/.h":    &fstest.MapFile{},
+}
+
+func TestPrintTree(t *testing.T) {
+	dir, err := ctx.CreateDirectoryChainFS(printFS, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Screen{CurrentDir: dir}
+
+	cases := []struct {
+		opts     printOptions
+		expected string
+	}{
+		{printOptions{}, "/root\n├─a/\n│ ├─b/\n│ │ └─x\n│ └─y\n└─c/\n  └─z\n"},
+		{printOptions{depth: 1}, "/root\n├─a/\n└─c/\n"},
+		{printOptions{match: func(name string) bool { return name == "x" }}, "/root\n└─a/\n  └─b/\n    └─x\n"},
+	}
+	for _, c := range cases {
+		out := bytes.Buffer{}
+		if err := s.printTree(&out, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.expected {
+			t.Error(fmt.Sprintf("Expected:\n%s\nFound:\n%s", c.expected, out.String()))
+		}
+	}
+}
+
+func TestAnsiColor(t *testing.T) {
+	cases := []struct {
+		attr     termbox.Attribute
+		expected string
+	}{
+		{termbox.ColorDefault, "text"},
+		{termbox.ColorYellow, "\x1b[33mtext\x1b[0m"},
+		{termbox.ColorLightBlue | termbox.AttrBold, "\x1b[94;1mtext\x1b[0m"},
+	}
+	for _, c := range cases {
+		if found := ansiColor(c.attr, "text"); found != c.expected {
+			t.Error(fmt.Sprintf("Expected %q, found %q", c.expected, found))
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Renderer is a grid of cells that the screen is drawn on, and the source of the events that it handles
+type Renderer interface {
+	Size() (width, height int)
+	SetCell(x, y int, ch rune, fg, bg termbox.Attribute)
+	Clear(fg, bg termbox.Attribute)
+	Flush()
+	PollEvent() termbox.Event
+	Interrupt()                     // Makes PollEvent return an EventInterrupt
+	RunProgram(cmd *exec.Cmd) error // Runs a program that takes over the terminal, such as an editor, and waits for it to exit
+}
+
+// Draws on the terminal with termbox, which must be initialized
+type termboxRenderer struct{}
+
+func (termboxRenderer) Size() (int, int) { return termbox.Size() }
+
+func (termboxRenderer) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	termbox.SetCell(x, y, ch, fg, bg)
+}
+
+func (termboxRenderer) Clear(fg, bg termbox.Attribute) { termbox.Clear(fg, bg) }
+
+func (termboxRenderer) Flush() { termbox.Flush() }
+
+func (termboxRenderer) PollEvent() termbox.Event { return termbox.PollEvent() }
+
+func (termboxRenderer) Interrupt() { termbox.Interrupt() }
+
+// The terminal is given back to the program while it runs, then termbox is initialized again
+// with the same modes. The program runs on the terminal itself, like termbox does, since stdout
+// is read by the wrapper script for the command to exit with.
+func (termboxRenderer) RunProgram(cmd *exec.Cmd) error {
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer tty.Close()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	}
+	outputMode := termbox.SetOutputMode(termbox.OutputCurrent)
+	termbox.Close()
+	runErr := cmd.Run()
+	if err := termbox.Init(); err != nil {
+		return err
+	}
+	termbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
+	termbox.SetOutputMode(outputMode)
+	return runErr
+}
+
+// Draws into cells in memory and returns events from a queue, to run the screen without a terminal
+type memRenderer struct {
+	width, height int
+	cells         []termbox.Cell
+	events        chan termbox.Event
+}
+
+func newMemRenderer(width, height int) *memRenderer {
+	r := &memRenderer{width: width, height: height, events: make(chan termbox.Event, 64)}
+	r.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	return r
+}
+
+func (r *memRenderer) Size() (int, int) { return r.width, r.height }
+
+// Cells outside of the grid are ignored, as they are by termbox
+func (r *memRenderer) SetCell(x, y int, ch rune, fg, bg termbox.Attribute) {
+	if x < 0 || x >= r.width || y < 0 || y >= r.height {
+		return
+	}
+	r.cells[y*r.width+x] = termbox.Cell{Ch: ch, Fg: fg, Bg: bg}
+}
+
+func (r *memRenderer) Clear(fg, bg termbox.Attribute) {
+	r.cells = make([]termbox.Cell, r.width*r.height)
+	for ii := range r.cells {
+		r.cells[ii] = termbox.Cell{Ch: ' ', Fg: fg, Bg: bg}
+	}
+}
+
+func (r *memRenderer) Flush() {}
+
+// Returns the next event of the queue, waiting for one if it is empty
+func (r *memRenderer) PollEvent() termbox.Event { return <-r.events }
+
+func (r *memRenderer) Interrupt() {
+	r.events <- termbox.Event{Type: termbox.EventInterrupt}
+}
+
+// Runs the program without a terminal
+func (r *memRenderer) RunProgram(cmd *exec.Cmd) error { return cmd.Run() }
+
+// Resize the grid, clearing it, and queue the event that termbox sends when the terminal is resized
+func (r *memRenderer) Resize(width, height int) {
+	r.width, r.height = width, height
+	r.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	r.events <- termbox.Event{Type: termbox.EventResize, Width: width, Height: height}
+}
+
+// Returns the cell at a position of the grid
+func (r *memRenderer) Cell(x, y int) termbox.Cell {
+	return r.cells[y*r.width+x]
+}
+
+// Returns the characters of the grid, one line per row without trailing spaces. A wide character
+// takes the cell it is drawn in and the one after it, which is left out.
+func (r *memRenderer) String() string {
+	var b strings.Builder
+	for y := 0; y < r.height; y++ {
+		var line strings.Builder
+		for x := 0; x < r.width; x++ {
+			ch := r.Cell(x, y).Ch
+			line.WriteRune(ch)
+			x += max(runeWidth(ch), 1) - 1
+		}
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
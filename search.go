@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Number of directory levels below the current directory that are searched
+const searchDepth = 8
+
+// How often results found in the background are added to the list
+const resultInterval = 50 * time.Millisecond
+
+// Number of files whose contents are searched at the same time
+const grepWorkers = 8
+
+// Files larger than this are not searched for their contents
+const grepMaxFileSize = 4 * 1024 * 1024
+
+// An item in a list of results that refers to a file below a directory
+type listItem struct {
+	label string // Text shown in the list
+	path  string // Path of the file relative to the directory the list is for
+	isDir bool
+	rank  int // Items with lower ranks are listed first
+}
+
+// A scrollable list of results that is shown in place of the tree
+type resultList struct {
+	dir    *ctx.Directory // Directory that the results are below
+	items  []listItem
+	idx    int  // Index of the selected item
+	done   bool // True once there are no more results to come
+	ranked bool // Keep the items ordered by rank rather than the order they were found in
+	cancel context.CancelFunc
+}
+
+// Add items to the list, keeping it ordered by rank if it is ranked
+func (l *resultList) add(items []listItem) {
+	l.items = append(l.items, items...)
+	if !l.ranked {
+		return
+	}
+	sort.SliceStable(l.items, func(i, j int) bool {
+		if l.items[i].rank != l.items[j].rank {
+			return l.items[i].rank < l.items[j].rank
+		}
+		return len(l.items[i].path) < len(l.items[j].path)
+	})
+}
+
+// Move the selected item, stopping at either end of the list
+func (l *resultList) move(dy int) {
+	l.idx = max(0, min(len(l.items)-1, l.idx+dy))
+}
+
+// Stop looking for more results
+func (l *resultList) stop() {
+	if l.cancel != nil {
+		l.cancel()
+	}
+}
+
+// Draws the list of results from y0 to the bottom of the screen, scrolled so that the
+// selected item is visible
+func (s *Screen) drawResultList(l *resultList, y0 int) {
+	screenWidth, screenHeight := s.renderer.Size()
+	rows := screenHeight - y0 - 1
+
+	status := fmt.Sprintf("%d results below %s", len(l.items), l.dir.AbsPath)
+	if !l.done {
+		status += " (searching...)"
+	}
+	s.Print(0, y0, termbox.ColorWhite, termbox.ColorDefault, status)
+
+	scroll := max(0, l.idx-rows+1)
+	for ii := scroll; ii < len(l.items) && ii-scroll < rows; ii++ {
+		item := l.items[ii]
+		color := s.fileColor
+		if ii == l.idx {
+			color = s.highlightedColor
+		} else if item.isDir {
+			color = s.directoryColor
+		}
+		s.Print(2, y0+1+ii-scroll, color, termbox.ColorDefault, truncate(printable(item.label), screenWidth-2))
+	}
+}
+
+// Collects the values sent on a channel in the background and adds them to the list in
+// batches on the main loop. The list is done when the channel is closed.
+func collectResults(s *Screen, l *resultList, items <-chan listItem) {
+	ticker := time.NewTicker(resultInterval)
+	defer ticker.Stop()
+
+	var batch []listItem
+	flush := func(done bool) {
+		pending := batch
+		batch = nil
+		s.post(func() {
+			l.add(pending)
+			l.done = done
+		})
+	}
+	for {
+		select {
+		case item, ok := <-items:
+			if !ok {
+				flush(true)
+				return
+			}
+			batch = append(batch, item)
+		case <-ticker.C:
+			if len(batch) > 0 {
+				flush(false)
+			}
+		}
+	}
+}
+
+// Replace the list of results with a new one below the current directory, cancelling the
+// previous search. find is run in the background to send the items of the list, the context
+// it is given is cancelled when the list is replaced or closed. If find is nil the list is empty.
+func (s *Screen) startResultList(ranked bool, find func(c context.Context, dir *ctx.Directory, items chan<- listItem)) {
+	if s.results != nil {
+		s.results.stop()
+	}
+	l := &resultList{dir: s.CurrentDir, ranked: ranked}
+	s.results = l
+	if find == nil {
+		l.done = true
+		return
+	}
+
+	c, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	items := make(chan listItem)
+	go func() {
+		find(c, l.dir, items)
+		close(items)
+	}()
+	go collectResults(s, l, items)
+}
+
+// Start searching the files below the current directory for names that match the search string
+func (s *Screen) startRecursiveSearch() {
+	query := string(s.searchString)
+	if query == "" {
+		s.startResultList(true, nil)
+		return
+	}
+	opts := ctx.SearchOptions{MaxDepth: searchDepth, ShowHidden: s.CurrentDir.ShowHidden}
+	s.startResultList(true, func(c context.Context, dir *ctx.Directory, items chan<- listItem) {
+		found := make(chan ctx.SearchResult)
+		go func() {
+			dir.Search(c, query, opts, found)
+			close(found)
+		}()
+		for r := range found {
+			label := r.Path
+			if r.IsDir {
+				label += "/"
+			}
+			items <- listItem{label: label, path: r.Path, isDir: r.IsDir, rank: r.Rank}
+		}
+	})
+}
+
+// Start searching the contents of the files below the current directory for the search string.
+// Results are listed in the order they are found.
+func (s *Screen) startGrep() {
+	text := string(s.searchString)
+	if text == "" {
+		s.startResultList(false, nil)
+		return
+	}
+	opts := ctx.GrepOptions{
+		SearchOptions: ctx.SearchOptions{MaxDepth: searchDepth, ShowHidden: s.CurrentDir.ShowHidden},
+		Workers:       grepWorkers,
+		MaxFileSize:   grepMaxFileSize,
+	}
+	s.startResultList(false, func(c context.Context, dir *ctx.Directory, items chan<- listItem) {
+		found := make(chan ctx.GrepResult)
+		go func() {
+			dir.Grep(c, text, opts, found)
+			close(found)
+		}()
+		for r := range found {
+			line := strings.TrimSpace(strings.Replace(r.Text, "\t", " ", -1))
+			items <- listItem{label: fmt.Sprintf("%s:%d: %s", r.Path, r.Line, line), path: r.Path}
+		}
+	})
+}
+
+// Stop showing the list of results
+func (s *Screen) closeResults() {
+	if s.results != nil {
+		s.results.stop()
+		s.results = nil
+	}
+}
+
+// Rebuild the directory chain so that the selector lands on the selected result
+func (s *Screen) jumpToResult() error {
+	l := s.results
+	if l == nil || len(l.items) == 0 {
+		return nil
+	}
+	return s.jumpTo(l.dir, l.items[l.idx].path)
+}
+
+// Rebuild the directory chain so that the selector lands on the file at rel, relative to base.
+// The hidden file visibility and sort order of base are kept for the new chain.
+func (s *Screen) jumpTo(base *ctx.Directory, rel string) error {
+	var dir *ctx.Directory
+	var err error
+	target := path.Join(base.AbsPath, rel)
+	apply := func(d *ctx.Directory) {
+		d.ShowHidden = base.ShowHidden
+		d.SortMode = base.SortMode
+		d.SortDesc = base.SortDesc
+		d.UpdateContents()
+	}
+
+	if base.IsLocal() {
+		dir, err = ctx.CreateDirectoryChain(path.Dir(target))
+		if err != nil {
+			return err
+		}
+		// The new chain replaces the old one, archives that are open in the old one are closed
+		if top := s.CurrentDir; top != nil {
+			for top.Parent != nil {
+				top = top.Parent
+			}
+			top.CloseArchives()
+		}
+		for d := dir; d != nil; d = d.Parent {
+			apply(d)
+			if d.Child != nil {
+				d.SelectFile(path.Base(d.Child.AbsPath))
+			}
+		}
+	} else {
+		// Directories inside archives can only be reached by descending into them
+		dir = base
+		for _, name := range strings.Split(path.Dir(rel), "/") {
+			if name == "." {
+				break
+			}
+			if !dir.SelectFile(name) {
+				return fmt.Errorf("%s not found in %s", name, dir.AbsPath)
+			}
+			if dir, err = dir.Descend(); err != nil {
+				return err
+			}
+			apply(dir)
+		}
+	}
+	dir.SelectFile(path.Base(target))
+	s.CurrentDir = dir
+	return nil
+}
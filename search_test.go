@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+func TestResultList(t *testing.T) {
+	l := &resultList{ranked: true}
+	l.add([]listItem{{path: "a/b/c", rank: 1}, {path: "d", rank: 2}})
+	l.add([]listItem{{path: "e", rank: 1}, {path: "f", rank: 0}})
+	var paths []string
+	for _, item := range l.items {
+		paths = append(paths, item.path)
+	}
+	if expected := "[f e a/b/c d]"; fmt.Sprint(paths) != expected {
+		t.Error(fmt.Sprintf("Expected %s, found %s", expected, paths))
+	}
+
+	l.move(10)
+	if l.idx != 3 {
+		t.Error(fmt.Sprintf("Expected the selector to stop at 3, found %d", l.idx))
+	}
+	l.move(-10)
+	if l.idx != 0 {
+		t.Error(fmt.Sprintf("Expected the selector to stop at 0, found %d", l.idx))
+	}
+}
+
+func TestJumpTo(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/a/b/target": &fstest.MapFile{},
+		"root/a/b/other":  &fstest.MapFile{},
+		"root/c":          &fstest.MapFile{},
+	}
+	base, err := ctx.NewDirectoryFS(fsys, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base.SortDesc = true
+	s := Screen{CurrentDir: base}
+	if err := s.jumpTo(base, "a/b/target"); err != nil {
+		t.Fatal(err)
+	}
+	if s.CurrentDir.AbsPath != "/root/a/b" {
+		t.Error(fmt.Sprintf("Expected to be in /root/a/b, found %s", s.CurrentDir.AbsPath))
+	}
+	if f, _ := s.CurrentDir.CurrentFile(); f == nil || f.Name() != "target" {
+		t.Error(fmt.Sprintf("Expected target to be selected, found %v", f))
+	}
+	if !s.CurrentDir.SortDesc {
+		t.Error("Expected the sort order to be kept")
+	}
+	if err := s.jumpTo(base, "missing/file"); err == nil {
+		t.Error("Expected an error jumping to a missing directory")
+	}
+}
+
+func TestJumpOutOfArchive(t *testing.T) {
+	root := t.TempDir()
+	f, err := os.Create(filepath.Join(root, "test.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	w.Create("inner.txt")
+	w.Close()
+	f.Close()
+	os.WriteFile(filepath.Join(root, "file"), nil, 0644)
+
+	dir, err := ctx.CreateDirectoryChain(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir.SelectFile("test.zip")
+	archive, err := dir.Descend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Screen{CurrentDir: archive}
+	if err := s.jumpTo(dir, "file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.ReadFile(archive.FS, "inner.txt"); err == nil {
+		t.Error("Expected the archive to be closed once the chain it is in is replaced")
+	}
+}
+
+func TestUnrankedResultList(t *testing.T) {
+	l := &resultList{}
+	l.add([]listItem{{path: "b", rank: 1}, {path: "a", rank: 0}})
+	if l.items[0].path != "b" {
+		t.Error("Expected the items of an unranked list to stay in the order they were added")
+	}
+}
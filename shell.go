@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Shell is a dialect of shell that the exit command is evaluated by
+type Shell int
+
+const (
+	ShellPOSIX Shell = iota
+	ShellZsh
+	ShellFish
+)
+
+// Returns the shell with the given name
+func ParseShell(name string) (Shell, error) {
+	switch name {
+	case "posix", "sh", "bash", "dash", "ksh":
+		return ShellPOSIX, nil
+	case "zsh":
+		return ShellZsh, nil
+	case "fish":
+		return ShellFish, nil
+	}
+	return ShellPOSIX, fmt.Errorf("unknown shell %q, expected posix, zsh or fish", name)
+}
+
+// Characters that have no special meaning to any of the shells, anywhere in a word
+const shellSafeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+.,:/@"
+
+// Quote a string so that the shell treats it as a single literal word
+func (sh Shell) Quote(arg string) string {
+	if arg != "" && strings.Trim(arg, shellSafeChars) == "" {
+		return arg
+	}
+	switch sh {
+	case ShellZsh:
+		return quoteANSIC(arg)
+	case ShellFish:
+		// Within single quotes fish only treats \\ and \' as escapes
+		r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+		return "'" + r.Replace(arg) + "'"
+	}
+	// Nothing is special within single quotes, a single quote has to be closed, escaped and reopened
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// Quote the string with $'...' so that control characters and invalid UTF-8 are written as escape
+// sequences, keeping the command on a single printable line. zsh and bash both support this quoting.
+func quoteANSIC(arg string) string {
+	b := strings.Builder{}
+	b.WriteString("$'")
+	for ii := 0; ii < len(arg); {
+		r, size := utf8.DecodeRuneInString(arg[ii:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			fmt.Fprintf(&b, `\x%02x`, arg[ii])
+		case r == '\\' || r == '\'':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case !unicode.IsPrint(r) && r < 0x80:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		case !unicode.IsPrint(r):
+			// Write the UTF-8 encoding byte by byte, \u depends on the locale of the shell
+			for _, c := range []byte(arg[ii : ii+size]) {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			}
+		default:
+			b.WriteRune(r)
+		}
+		ii += size
+	}
+	b.WriteString("'")
+	return b.String()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// File names that break or execute code when they are not quoted correctly
+var hostileNames = []string{
+	"plain",
+	"with space",
+	"  leading and trailing  ",
+	"foo; rm -rf ~",
+	"$(touch pwned)",
+	"`touch pwned`",
+	"$HOME",
+	"${HOME}",
+	"it's",
+	"'",
+	"''",
+	`"double"`,
+	`back\slash`,
+	`trailing\`,
+	"*",
+	"?",
+	"[abc]",
+	"{a,b}",
+	"~",
+	"~root",
+	"!bang",
+	"#hash",
+	"=equals",
+	"%percent",
+	"-dash",
+	"a&b|c>d<e",
+	"new\nline",
+	"tab\there",
+	"\x1b[31mescape",
+	"\x7fdelete",
+	"日本語 ファイル",
+	"emoji 😀",
+	"\xff\xfeinvalid utf8",
+	"zero​width",
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := []struct {
+		shell    Shell
+		arg      string
+		expected string
+	}{
+		{ShellPOSIX, "/usr/local/bin", "/usr/local/bin"},
+		{ShellPOSIX, "", "''"},
+		{ShellPOSIX, "foo; rm -rf ~", "'foo; rm -rf ~'"},
+		{ShellPOSIX, "it's", `'it'\''s'`},
+		{ShellZsh, "it's", `$'it\'s'`},
+		{ShellZsh, "new\nline\x1b", `$'new\nline\x1b'`},
+		{ShellZsh, "\xff", `$'\xff'`},
+		{ShellFish, `it's\`, `'it\'s\\'`},
+		{ShellFish, "=equals", "'=equals'"},
+	}
+	for _, c := range cases {
+		if found := c.shell.Quote(c.arg); found != c.expected {
+			t.Error(fmt.Sprintf("Expected %q to be quoted as %s, found %s", c.arg, c.expected, found))
+		}
+	}
+}
+
+func TestParseShell(t *testing.T) {
+	for name, expected := range map[string]Shell{"posix": ShellPOSIX, "bash": ShellPOSIX, "zsh": ShellZsh, "fish": ShellFish} {
+		if sh, err := ParseShell(name); err != nil || sh != expected {
+			t.Error(fmt.Sprintf("Expected %s to parse as %d, found %d (%v)", name, expected, sh, err))
+		}
+	}
+	if _, err := ParseShell("cmd.exe"); err == nil {
+		t.Error("Expected error for unknown shell")
+	}
+}
+
+// Evaluate the full command of an exit command that prints its arguments in the given shell
+// and check that every argument comes out exactly as it went in.
+func TestFullCommandRoundTrip(t *testing.T) {
+	shells := []struct {
+		shell Shell
+		exe   string
+		args  []string
+	}{
+		{ShellPOSIX, "sh", []string{"-c"}},
+		{ShellPOSIX, "bash", []string{"-c"}},
+		{ShellZsh, "zsh", []string{"-f", "-c"}},
+		// bash supports the same $'...' quoting that is used for zsh
+		{ShellZsh, "bash", []string{"-c"}},
+		{ShellFish, "fish", []string{"--no-config", "-c"}},
+	}
+
+	for _, sh := range shells {
+		exe, err := exec.LookPath(sh.exe)
+		if err != nil {
+			t.Log(fmt.Sprintf("Skipping %s, it is not installed", sh.exe))
+			continue
+		}
+		cmd := ExitCommand{command: `printf '%s\0'`, args: hostileNames, shell: sh.shell}
+		dir, err := ioutil.TempDir("", "itree")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		c := exec.Command(exe, append(sh.args, cmd.FullCommand())...)
+		c.Dir = dir
+		out, err := c.Output()
+		if err != nil {
+			t.Error(fmt.Sprintf("%s failed to evaluate %s: %v", sh.exe, cmd.FullCommand(), err))
+			continue
+		}
+		found := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+		if len(found) != len(hostileNames) {
+			t.Error(fmt.Sprintf("%s: expected %d arguments, found %d: %q", sh.exe, len(hostileNames), len(found), found))
+			continue
+		}
+		for ii, name := range hostileNames {
+			if found[ii] != name {
+				t.Error(fmt.Sprintf("%s: expected %q, found %q", sh.exe, name, found[ii]))
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+			t.Error(fmt.Sprintf("%s executed code from a file name", sh.exe))
+		}
+	}
+}
+
+// Source the itree.sh wrapper with a stand-in for itree2 that exits into a directory with
+// a hostile name, and check that the wrapper changes into exactly that directory and executes
+// nothing else.
+func TestWrapperRoundTrip(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	wrapper, err := filepath.Abs("itree.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home, err := ioutil.TempDir("", "itree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	os.MkdirAll(filepath.Join(home, ".config", "itree"), 0755)
+	ioutil.WriteFile(filepath.Join(home, ".config", "itree", "preferences"), nil, 0644)
+	bin := filepath.Join(home, "bin")
+	os.Mkdir(bin, 0755)
+	// Output on stdout, like that of --print, is shown and never executed
+	script := "#!/bin/sh\necho touch pwned\ncat \"$HOME/command\" >&3\n"
+	ioutil.WriteFile(filepath.Join(bin, "itree2"), []byte(script), 0755)
+
+	for _, name := range hostileNames {
+		if name == "~" {
+			// Not a hostile name for a directory that is created relative to home
+			continue
+		}
+		dir := filepath.Join(home, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Error(err)
+			continue
+		}
+		cmd := ExitCommand{command: "cd", args: []string{dir}}
+		ioutil.WriteFile(filepath.Join(home, "command"), []byte(cmd.FullCommand()), 0644)
+
+		c := exec.Command(bash, "-c", `. "$0" && printf '%s' "$PWD"`, wrapper)
+		c.Dir = home
+		c.Env = []string{"HOME=" + home, "PATH=" + bin + ":/usr/bin:/bin"}
+		stderr := bytes.Buffer{}
+		c.Stderr = &stderr
+		out, err := c.Output()
+		if err != nil {
+			t.Error(fmt.Sprintf("Wrapper failed for %q: %v %s", name, err, stderr.String()))
+		} else if string(out) != "touch pwned\n"+dir {
+			t.Error(fmt.Sprintf("Expected the wrapper to change to %q, found %q", dir, out))
+		}
+		os.RemoveAll(dir)
+	}
+	if _, err := os.Stat(filepath.Join(home, "pwned")); err == nil {
+		t.Error("The wrapper executed code from a directory name")
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Kinds of colors, in order of how many colors there are to choose from
+const (
+	colorDefault = iota // The terminal's default color
+	colorBasic          // One of the 16 colors that every terminal has, index 0 to 15
+	color256            // One of the 256 colors of the xterm palette
+	colorRGB            // A 24 bit color
+)
+
+// Color is a color and the attributes of text, independent of the number of colors the terminal can show
+type Color struct {
+	kind    int
+	index   uint8
+	r, g, b uint8
+	attrs   termbox.Attribute // Bold, underline and reverse
+}
+
+// The RGB values of the 16 basic colors in xterm
+var basicPalette = [16][3]uint8{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0}, {0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0}, {92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// Names of the basic colors, the bright colors are prefixed with "bright-"
+var basicColorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+var colorAttributes = map[string]termbox.Attribute{
+	"bold":      termbox.AttrBold,
+	"underline": termbox.AttrUnderline,
+	"reverse":   termbox.AttrReverse,
+}
+
+// Theme is the set of colors that items are drawn with
+type Theme struct {
+	Highlighted Color // The selected item
+	Filtered    Color // Items that match the filter
+	Marked      Color
+	Directory   Color
+	File        Color
+}
+
+// The built-in themes, by name. The colors are written as they are in the config file.
+var themes = map[string][5]string{
+	"default":   {"cyan", "green", "magenta", "yellow", "white"},
+	"mono":      {"reverse default", "bold default", "underline default", "bold default", "default"},
+	"solarized": {"bold #268bd2", "#859900", "#d33682", "#b58900", "#93a1a1"},
+	"gruvbox":   {"bold #83a598", "#b8bb26", "#d3869b", "#fabd2f", "#ebdbb2"},
+}
+
+// Returns the built-in theme with the given name
+func builtinTheme(name string) (Theme, error) {
+	colors, ok := themes[name]
+	if !ok {
+		names := make([]string, 0, len(themes))
+		for n := range themes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Theme{}, fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	var parsed [5]Color
+	for ii, c := range colors {
+		parsed[ii], _ = parseColor(c)
+	}
+	return Theme{parsed[0], parsed[1], parsed[2], parsed[3], parsed[4]}, nil
+}
+
+// Parse a color, optionally preceded by "bold", "underline" or "reverse". A color is "default",
+// the name of a basic color such as "red" or "bright-red", a color of the 256 color palette
+// such as "color208", or a 24 bit color such as "#ff8700".
+func parseColor(s string) (Color, error) {
+	var c Color
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return c, errors.New("missing color")
+	}
+	for _, w := range words[:len(words)-1] {
+		attr, ok := colorAttributes[w]
+		if !ok {
+			return c, fmt.Errorf("unknown attribute %q, expected bold, underline or reverse", w)
+		}
+		c.attrs |= attr
+	}
+
+	name := words[len(words)-1]
+	switch {
+	case name == "default":
+		return c, nil
+	case strings.HasPrefix(name, "#"):
+		rgb, err := strconv.ParseUint(name[1:], 16, 32)
+		if err != nil || len(name) != 7 {
+			return c, fmt.Errorf("invalid color %q, expected #rrggbb", name)
+		}
+		c.kind = colorRGB
+		c.r, c.g, c.b = uint8(rgb>>16), uint8(rgb>>8), uint8(rgb)
+		return c, nil
+	case strings.HasPrefix(name, "color"):
+		n, err := strconv.ParseUint(name[len("color"):], 10, 8)
+		if err != nil {
+			return c, fmt.Errorf("invalid color %q, expected color0 to color255", name)
+		}
+		c.kind = color256
+		c.index = uint8(n)
+		return c, nil
+	}
+	for ii, basic := range basicColorNames {
+		if name == basic {
+			c.kind, c.index = colorBasic, uint8(ii)
+			return c, nil
+		} else if name == "bright-"+basic {
+			c.kind, c.index = colorBasic, uint8(ii+8)
+			return c, nil
+		}
+	}
+	return c, fmt.Errorf("unknown color %q, expected default, %s, bright-<color>, color0 to color255 or #rrggbb",
+		name, strings.Join(basicColorNames, ", "))
+}
+
+// Returns the termbox attribute that shows the color in the output mode
+func (c Color) attribute(mode termbox.OutputMode) termbox.Attribute {
+	switch mode {
+	case termbox.OutputRGB:
+		if c.kind == colorDefault {
+			if c.attrs != 0 {
+				// termbox can only show attributes with a color in this mode
+				return termbox.RGBToAttribute(229, 229, 229) | c.attrs
+			}
+			return termbox.ColorDefault
+		}
+		r, g, b := c.rgb()
+		return termbox.RGBToAttribute(r, g, b) | c.attrs
+	case termbox.Output256:
+		switch c.kind {
+		case colorBasic, color256:
+			return (termbox.Attribute(c.index) + 1) | c.attrs
+		case colorRGB:
+			return (termbox.Attribute(nearest256(c.r, c.g, c.b)) + 1) | c.attrs
+		}
+	default:
+		switch c.kind {
+		case colorBasic:
+			return (termbox.Attribute(c.index) + 1) | c.attrs
+		case color256, colorRGB:
+			r, g, b := c.rgb()
+			return (termbox.Attribute(nearestBasic(r, g, b)) + 1) | c.attrs
+		}
+	}
+	return termbox.ColorDefault | c.attrs
+}
+
+// Returns the RGB value of the color
+func (c Color) rgb() (uint8, uint8, uint8) {
+	switch c.kind {
+	case colorBasic:
+		p := basicPalette[c.index]
+		return p[0], p[1], p[2]
+	case color256:
+		return paletteRGB(c.index)
+	}
+	return c.r, c.g, c.b
+}
+
+// Returns the RGB value of a color of the 256 color palette
+func paletteRGB(n uint8) (uint8, uint8, uint8) {
+	switch {
+	case n < 16:
+		p := basicPalette[n]
+		return p[0], p[1], p[2]
+	case n < 232:
+		// A 6x6x6 cube of colors
+		levels := [6]uint8{0, 95, 135, 175, 215, 255}
+		n -= 16
+		return levels[n/36], levels[n/6%6], levels[n%6]
+	default:
+		// A ramp of grays
+		gray := 8 + 10*(n-232)
+		return gray, gray, gray
+	}
+}
+
+// Returns the square of the distance between two colors
+func colorDistance(r1, g1, b1, r2, g2, b2 uint8) int {
+	dr, dg, db := int(r1)-int(r2), int(g1)-int(g2), int(b1)-int(b2)
+	return dr*dr + dg*dg + db*db
+}
+
+// Returns the index of the basic color that is closest to the RGB value
+func nearestBasic(r, g, b uint8) uint8 {
+	best := 0
+	for ii, p := range basicPalette {
+		if colorDistance(r, g, b, p[0], p[1], p[2]) < colorDistance(r, g, b, basicPalette[best][0], basicPalette[best][1], basicPalette[best][2]) {
+			best = ii
+		}
+	}
+	return uint8(best)
+}
+
+// Returns the index of the color of the 256 color palette that is closest to the RGB value.
+// The basic colors are skipped since terminals often change them.
+func nearest256(r, g, b uint8) uint8 {
+	best := uint8(16)
+	for n := 16; n < 256; n++ {
+		pr, pg, pb := paletteRGB(uint8(n))
+		br, bg, bb := paletteRGB(best)
+		if colorDistance(r, g, b, pr, pg, pb) < colorDistance(r, g, b, br, bg, bb) {
+			best = uint8(n)
+		}
+	}
+	return best
+}
+
+// Returns the output mode for a color mode of the config: 16, 256, truecolor, or auto to
+// detect the colors the terminal supports from the environment
+func outputModeFor(colorMode string) termbox.OutputMode {
+	switch colorMode {
+	case "256":
+		return termbox.Output256
+	case "truecolor":
+		return termbox.OutputRGB
+	case "auto":
+		if ct := os.Getenv("COLORTERM"); ct == "truecolor" || ct == "24bit" {
+			return termbox.OutputRGB
+		}
+		if strings.Contains(os.Getenv("TERM"), "256color") {
+			return termbox.Output256
+		}
+	}
+	return termbox.OutputNormal
+}
+
+// Change the output mode that the colors are shown in
+func (s *Screen) setOutputMode(mode termbox.OutputMode) {
+	s.outputMode = mode
+	s.highlightedColor = s.theme.Highlighted.attribute(mode)
+	s.filteredColor = s.theme.Filtered.attribute(mode)
+	s.markedColor = s.theme.Marked.attribute(mode)
+	s.directoryColor = s.theme.Directory.attribute(mode)
+	s.fileColor = s.theme.File.attribute(mode)
+}
+
+// Returns the color of a file that is not selected, marked or filtered. Files are colored by
+// LS_COLORS if it is enabled, otherwise by the theme.
+func (s *Screen) colorOf(f os.FileInfo) termbox.Attribute {
+	if s.lsColors != nil {
+		if c, ok := s.lsColors.colorOf(f); ok {
+			return c.attribute(s.outputMode)
+		}
+	}
+	if f.IsDir() {
+		return s.directoryColor
+	}
+	return s.fileColor
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestParseColor(t *testing.T) {
+	cases := []struct {
+		color    string
+		expected Color
+	}{
+		{"default", Color{}},
+		{"bold default", Color{attrs: termbox.AttrBold}},
+		{"red", Color{kind: colorBasic, index: 1}},
+		{"bright-red", Color{kind: colorBasic, index: 9}},
+		{"underline color208", Color{kind: color256, index: 208, attrs: termbox.AttrUnderline}},
+		{"#ff8700", Color{kind: colorRGB, r: 0xff, g: 0x87}},
+	}
+	for _, c := range cases {
+		found, err := parseColor(c.color)
+		if err != nil {
+			t.Error(err)
+		} else if found != c.expected {
+			t.Error(fmt.Sprintf("Expected %q to parse as %+v, found %+v", c.color, c.expected, found))
+		}
+	}
+	for _, invalid := range []string{"", "purple", "#fff", "#gggggg", "color300", "blinking red"} {
+		if _, err := parseColor(invalid); err == nil {
+			t.Error(fmt.Sprintf("Expected an error for %q", invalid))
+		}
+	}
+}
+
+func TestColorAttribute(t *testing.T) {
+	red := Color{kind: colorBasic, index: 1, attrs: termbox.AttrBold}
+	orange := Color{kind: colorRGB, r: 0xff, g: 0x87}
+	gray := Color{kind: color256, index: 244}
+	cases := []struct {
+		color    Color
+		mode     termbox.OutputMode
+		expected termbox.Attribute
+	}{
+		{red, termbox.OutputNormal, termbox.ColorRed | termbox.AttrBold},
+		{red, termbox.Output256, 2 | termbox.AttrBold},
+		{red, termbox.OutputRGB, termbox.RGBToAttribute(205, 0, 0) | termbox.AttrBold},
+		// Colors are approximated when the terminal cannot show them
+		{orange, termbox.Output256, 208 + 1},
+		{orange, termbox.OutputNormal, termbox.ColorYellow},
+		{orange, termbox.OutputRGB, termbox.RGBToAttribute(0xff, 0x87, 0)},
+		{gray, termbox.OutputNormal, termbox.ColorDarkGray},
+		{gray, termbox.OutputRGB, termbox.RGBToAttribute(128, 128, 128)},
+		{Color{}, termbox.OutputRGB, termbox.ColorDefault},
+	}
+	for _, c := range cases {
+		if found := c.color.attribute(c.mode); found != c.expected {
+			t.Error(fmt.Sprintf("Expected %+v in mode %d to be %x, found %x", c.color, c.mode, c.expected, found))
+		}
+	}
+}
+
+func TestBuiltinThemes(t *testing.T) {
+	for name, colors := range themes {
+		for _, c := range colors {
+			if _, err := parseColor(c); err != nil {
+				t.Error(fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+	theme, err := builtinTheme("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Screen{theme: theme}
+	s.setOutputMode(termbox.OutputNormal)
+	if s.directoryColor != termbox.ColorYellow || s.highlightedColor != termbox.ColorCyan {
+		t.Error("Expected the default theme to keep the original colors")
+	}
+}
+
+func TestOutputModeFor(t *testing.T) {
+	if outputModeFor("256") != termbox.Output256 || outputModeFor("truecolor") != termbox.OutputRGB ||
+		outputModeFor("16") != termbox.OutputNormal {
+		t.Error("Expected the color mode to select the output mode")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package trash
+
+// Devices are not known on this platform so everything is moved to the home trash
+func deviceOf(path string) (uint64, bool) {
+	return 0, false
+}
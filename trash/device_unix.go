@@ -0,0 +1,22 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package trash
+
+import (
+	"os"
+	"syscall"
+)
+
+// Returns the device that the file system of path is on
+func deviceOf(path string) (uint64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
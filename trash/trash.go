@@ -0,0 +1,302 @@
+// Package trash moves files to the trash and restores them, following the freedesktop.org
+// Trash specification that file managers on Linux and BSD share.
+//
+// Files are moved to the home trash, $XDG_DATA_HOME/Trash, when they are on the same file system
+// as it. Files on other file systems are moved to the trash at the top of their file system,
+// $topdir/.Trash/$uid if an administrator created $topdir/.Trash, otherwise $topdir/.Trash-$uid.
+// A trash holds the trashed items in files/ and a .trashinfo file for each in info/ that records
+// the path the item was deleted from and when.
+package trash
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+// Format of the deletion date of a .trashinfo file, in local time
+const dateFormat = "2006-01-02T15:04:05"
+
+const infoSuffix = ".trashinfo"
+
+// Trash is a trash directory
+type Trash struct {
+	Dir    string // The directory that contains files/ and info/
+	TopDir string // The top directory of the file system of a trash that is not the home trash, "" for the home trash
+}
+
+// Item is an item in a trash
+type Item struct {
+	Trash        *Trash
+	Name         string    // Name of the item in files/, which is unique in the trash
+	Path         string    // Absolute path that the item was deleted from
+	DeletionDate time.Time // Zero if it is not known
+}
+
+// Home returns the home trash, $XDG_DATA_HOME/Trash or ~/.local/share/Trash
+func Home() *Trash {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return &Trash{Dir: filepath.Join(dataHome, "Trash")}
+}
+
+// Returns the trash of the file system whose top directory is topdir, creating it if needed.
+// $topdir/.Trash is only used if it is a directory with the sticky bit set and not a link,
+// as the specification requires, otherwise $topdir/.Trash-$uid is used.
+func topDirTrash(topdir string, uid int) (*Trash, error) {
+	shared := filepath.Join(topdir, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		dir := filepath.Join(shared, strconv.Itoa(uid))
+		if err := os.MkdirAll(dir, 0700); err == nil {
+			return &Trash{Dir: dir, TopDir: topdir}, nil
+		}
+	}
+	dir := filepath.Join(topdir, fmt.Sprintf(".Trash-%d", uid))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Trash{Dir: dir, TopDir: topdir}, nil
+}
+
+// For returns the trash that the item at path is moved to
+func For(path string) (*Trash, error) {
+	home := Home()
+	if err := os.MkdirAll(home.Dir, 0700); err != nil {
+		return nil, err
+	}
+	dev, ok := deviceOf(filepath.Dir(path))
+	if homeDev, homeOK := deviceOf(home.Dir); !ok || !homeOK || dev == homeDev {
+		return home, nil
+	}
+	t, err := topDirTrash(mountPoint(filepath.Dir(path), dev), os.Getuid())
+	if err != nil {
+		// Items that cannot be trashed on their own file system are copied to the home trash
+		return home, nil
+	}
+	return t, nil
+}
+
+// Returns the top directory of the file system that dir is on, the last directory above it
+// that is on the same device
+func mountPoint(dir string, dev uint64) string {
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		if d, ok := deviceOf(parent); !ok || d != dev {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// Put moves the item at path to the trash
+func Put(path string) (Item, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Item{}, err
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return Item{}, err
+	}
+	t, err := For(path)
+	if err != nil {
+		return Item{}, err
+	}
+	return t.Put(path)
+}
+
+// Put moves the item at the absolute path into the trash
+func (t *Trash) Put(path string) (Item, error) {
+	files, info := filepath.Join(t.Dir, "files"), filepath.Join(t.Dir, "info")
+	for _, dir := range []string{files, info} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return Item{}, err
+		}
+	}
+
+	// Items are recorded under their original path in the home trash, and relative to the top
+	// directory in the trash of another file system
+	recorded := path
+	if t.TopDir != "" {
+		rel, err := filepath.Rel(t.TopDir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			recorded = rel
+		}
+	}
+	item := Item{Trash: t, Path: path, DeletionDate: time.Now().Truncate(time.Second)}
+	contents := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: recorded}).EscapedPath(), item.DeletionDate.Format(dateFormat))
+
+	// Creating the info file first reserves the name, so that two programs cannot pick the same one
+	base := filepath.Base(path)
+	for n := 1; ; n++ {
+		item.Name = base
+		if n > 1 {
+			item.Name = fmt.Sprintf("%s.%d", base, n)
+		}
+		f, err := os.OpenFile(item.infoPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return Item{}, err
+		}
+		if _, err := os.Lstat(item.FilePath()); err == nil {
+			// A file without info is in the way
+			f.Close()
+			os.Remove(item.infoPath())
+			continue
+		}
+		_, err = f.WriteString(contents)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(item.infoPath())
+			return Item{}, err
+		}
+		break
+	}
+
+	if err := ctx.MoveTo(path, item.FilePath()); err != nil {
+		os.Remove(item.infoPath())
+		return Item{}, err
+	}
+	return item, nil
+}
+
+// Items returns the items in the trash, ignoring info files that cannot be read
+func (t *Trash) Items() ([]Item, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(t.Dir, "info"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), infoSuffix) {
+			continue
+		}
+		item, err := t.readInfo(strings.TrimSuffix(e.Name(), infoSuffix))
+		if err != nil {
+			continue
+		}
+		if _, err := os.Lstat(item.FilePath()); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Read the .trashinfo file of the item with the given name
+func (t *Trash) readInfo(name string) (Item, error) {
+	item := Item{Trash: t, Name: name}
+	f, err := os.Open(item.infoPath())
+	if err != nil {
+		return item, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "[Trash Info]" {
+		return item, fmt.Errorf("%s: missing [Trash Info] header", item.infoPath())
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:eq]), strings.TrimSpace(line[eq+1:])
+		switch key {
+		case "Path":
+			p, err := url.PathUnescape(value)
+			if err != nil {
+				return item, fmt.Errorf("%s: invalid path: %v", item.infoPath(), err)
+			}
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(t.TopDir, p)
+			}
+			item.Path = filepath.Clean(p)
+		case "DeletionDate":
+			item.DeletionDate, _ = time.ParseInLocation(dateFormat, value, time.Local)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return item, err
+	}
+	if item.Path == "" || !filepath.IsAbs(item.Path) {
+		return item, fmt.Errorf("%s: missing path", item.infoPath())
+	}
+	return item, nil
+}
+
+// List returns the items of the home trash and of the trash of the file system that dir is on,
+// most recently deleted first
+func List(dir string) ([]Item, error) {
+	home := Home()
+	items, err := home.Items()
+	if err != nil {
+		return nil, err
+	}
+	dev, ok := deviceOf(dir)
+	if homeDev, homeOK := deviceOf(home.Dir); ok && (!homeOK || dev != homeDev) {
+		topdir := mountPoint(dir, dev)
+		for _, t := range []*Trash{
+			{Dir: filepath.Join(topdir, ".Trash", strconv.Itoa(os.Getuid())), TopDir: topdir},
+			{Dir: filepath.Join(topdir, fmt.Sprintf(".Trash-%d", os.Getuid())), TopDir: topdir},
+		} {
+			more, err := t.Items()
+			if err != nil {
+				continue
+			}
+			items = append(items, more...)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletionDate.After(items[j].DeletionDate)
+	})
+	return items, nil
+}
+
+// FilePath returns the path of the item in the trash
+func (i Item) FilePath() string {
+	return filepath.Join(i.Trash.Dir, "files", i.Name)
+}
+
+func (i Item) infoPath() string {
+	return filepath.Join(i.Trash.Dir, "info", i.Name+infoSuffix)
+}
+
+// Restore moves the item back to the path it was deleted from. Directories above the path that
+// no longer exist are created. An item is never restored over another one.
+func (i Item) Restore() error {
+	if _, err := os.Lstat(i.Path); err == nil {
+		return &os.PathError{Op: "restore", Path: i.Path, Err: os.ErrExist}
+	}
+	if err := os.MkdirAll(filepath.Dir(i.Path), 0777); err != nil {
+		return err
+	}
+	if err := ctx.MoveTo(i.FilePath(), i.Path); err != nil {
+		return err
+	}
+	if err := os.Remove(i.infoPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package trash
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Use a home trash in a temporary directory for the duration of a test
+func setHome(t *testing.T) string {
+	dataHome := t.TempDir()
+	old, ok := os.LookupEnv("XDG_DATA_HOME")
+	os.Setenv("XDG_DATA_HOME", dataHome)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv("XDG_DATA_HOME", old)
+		} else {
+			os.Unsetenv("XDG_DATA_HOME")
+		}
+	})
+	return filepath.Join(dataHome, "Trash")
+}
+
+func writeFile(t *testing.T, p, contents string) {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPutAndRestore(t *testing.T) {
+	trashDir := setHome(t)
+	// The files are next to the home trash so that they are on the same file system
+	root := filepath.Join(filepath.Dir(trashDir), "files")
+	first := filepath.Join(root, "my notes.txt")
+	writeFile(t, first, "first")
+
+	item, err := Put(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Trash.Dir != trashDir || item.Name != "my notes.txt" || item.Path != first {
+		t.Error(fmt.Sprintf("Expected the item to be in the home trash, found %+v in %s", item, item.Trash.Dir))
+	}
+	if _, err := os.Stat(first); err == nil {
+		t.Error("Expected the file to be moved")
+	}
+	info, _ := ioutil.ReadFile(filepath.Join(trashDir, "info", "my notes.txt.trashinfo"))
+	expected := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		strings.Replace(first, " ", "%20", -1), item.DeletionDate.Format(dateFormat))
+	if string(info) != expected {
+		t.Error(fmt.Sprintf("Expected the info file to be\n%s\nfound\n%s", expected, info))
+	}
+
+	// Items with the same name are given unique names in the trash
+	writeFile(t, first, "second")
+	if item, err = Put(first); err != nil || item.Name != "my notes.txt.2" {
+		t.Error(fmt.Sprintf("Expected a second item named my notes.txt.2, found %q, %v", item.Name, err))
+	}
+
+	items, err := List(root)
+	if err != nil || len(items) != 2 {
+		t.Fatal(fmt.Sprintf("Expected 2 items in the trash, found %v, %v", items, err))
+	}
+	for _, item := range items {
+		if item.Path != first {
+			t.Error(fmt.Sprintf("Expected the items to be deleted from %s, found %s", first, item.Path))
+		}
+	}
+
+	if err := items[0].Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if err := items[1].Restore(); err == nil {
+		t.Error("Expected an error restoring over an item")
+	}
+	if items, _ := Home().Items(); len(items) != 1 {
+		t.Error(fmt.Sprintf("Expected 1 item to be left in the trash, found %d", len(items)))
+	}
+	if _, err := os.Stat(filepath.Join(trashDir, "files", items[0].Name)); err == nil {
+		t.Error("Expected the restored item to be removed from the trash")
+	}
+}
+
+func TestRestoreCreatesParents(t *testing.T) {
+	trashDir := setHome(t)
+	dir := filepath.Join(filepath.Dir(trashDir), "a", "b")
+	writeFile(t, filepath.Join(dir, "c"), "c")
+	item, err := Put(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Dir(dir))
+	if err := item.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "c")); string(data) != "c" {
+		t.Error(fmt.Sprintf("Expected the directory to be restored with its contents, found %q", data))
+	}
+}
+
+func TestTopDirTrash(t *testing.T) {
+	topdir := t.TempDir()
+	trash, err := topDirTrash(topdir, 1000)
+	if err != nil || trash.Dir != filepath.Join(topdir, ".Trash-1000") {
+		t.Fatal(fmt.Sprintf("Expected .Trash-1000 without a shared trash, found %v, %v", trash, err))
+	}
+
+	// A shared trash without the sticky bit is not used
+	os.Mkdir(filepath.Join(topdir, ".Trash"), 0777)
+	if trash, _ := topDirTrash(topdir, 1000); trash.Dir != filepath.Join(topdir, ".Trash-1000") {
+		t.Error(fmt.Sprintf("Expected .Trash without the sticky bit to be ignored, found %s", trash.Dir))
+	}
+	os.Chmod(filepath.Join(topdir, ".Trash"), 0777|os.ModeSticky)
+	if trash, _ = topDirTrash(topdir, 1000); trash.Dir != filepath.Join(topdir, ".Trash", "1000") {
+		t.Error(fmt.Sprintf("Expected .Trash/1000, found %s", trash.Dir))
+	}
+
+	// Paths are recorded relative to the top directory
+	p := filepath.Join(topdir, "dir", "file")
+	writeFile(t, p, "file")
+	item, err := trash.Put(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := ioutil.ReadFile(filepath.Join(trash.Dir, "info", "file.trashinfo"))
+	if !strings.Contains(string(info), "\nPath=dir/file\n") {
+		t.Error(fmt.Sprintf("Expected a relative path in the info file, found\n%s", info))
+	}
+	items, err := trash.Items()
+	if err != nil || len(items) != 1 || items[0].Path != p || !items[0].DeletionDate.Equal(item.DeletionDate) {
+		t.Error(fmt.Sprintf("Expected the item to be read back, found %+v, %v", items, err))
+	}
+}
+
+func TestInvalidInfo(t *testing.T) {
+	trash := &Trash{Dir: t.TempDir()}
+	writeFile(t, filepath.Join(trash.Dir, "files", "a"), "a")
+	writeFile(t, filepath.Join(trash.Dir, "files", "b"), "b")
+	writeFile(t, filepath.Join(trash.Dir, "info", "a.trashinfo"), "Path=/a\n")
+	writeFile(t, filepath.Join(trash.Dir, "info", "b.trashinfo"), "[Trash Info]\nDeletionDate=2020-01-01T00:00:00\n")
+	writeFile(t, filepath.Join(trash.Dir, "info", "missing.trashinfo"), "[Trash Info]\nPath=/missing\n")
+	if items, err := trash.Items(); err != nil || len(items) != 0 {
+		t.Error(fmt.Sprintf("Expected invalid items to be ignored, found %+v, %v", items, err))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/trash"
+)
+
+// The items in the trash, shown in place of the tree
+type trashView struct {
+	items []trash.Item // Most recently deleted first
+	idx   int          // Index of the selected item
+}
+
+// Show the items of the trash that the current directory would be trashed to, and the home trash
+func (s *Screen) openTrash() {
+	dir := s.CurrentDir
+	for !dir.IsLocal() && dir.Parent != nil {
+		dir = dir.Parent
+	}
+	items, err := trash.List(dir.AbsPath)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	s.overlay = &trashView{items: items}
+}
+
+// Draws the items of the trash, scrolled so that the selected item is visible
+func (t *trashView) draw(s *Screen, y0 int) {
+	screenWidth, screenHeight := s.renderer.Size()
+	rows := screenHeight - y0 - 1
+
+	status := fmt.Sprintf("%d items in the trash, Enter restores the selected item and Esc closes the trash", len(t.items))
+	s.Print(0, y0, termbox.ColorWhite, termbox.ColorDefault, truncate(status, screenWidth))
+
+	scroll := max(0, t.idx-rows+1)
+	for ii := scroll; ii < len(t.items) && ii-scroll < rows; ii++ {
+		item := t.items[ii]
+		color := s.fileColor
+		if ii == t.idx {
+			color = s.highlightedColor
+		}
+		date := "unknown date    "
+		if !item.DeletionDate.IsZero() {
+			date = item.DeletionDate.Format("2006-01-02 15:04")
+		}
+		label := fmt.Sprintf("%s  %s", date, item.Path)
+		s.Print(2, y0+1+ii-scroll, color, termbox.ColorDefault, truncate(label, screenWidth-2))
+	}
+}
+
+// Handle a key while the trash is shown
+func (t *trashView) handleKey(s *Screen, ev termbox.Event) {
+	if idx, ok := listKey(ev, t.idx, len(t.items)); ok {
+		t.idx = idx
+		return
+	}
+	switch {
+	case ev.Key == termbox.KeyEnter || ev.Ch == 'r':
+		t.restore(s)
+	case ev.Key == termbox.KeyEsc || ev.Ch == 'q':
+		s.overlay = nil
+	default:
+		for _, keys := range s.keymap.keysFor("trash") {
+			if keys == keyName(ev.Ch, ev.Key) {
+				s.overlay = nil
+			}
+		}
+	}
+}
+
+// Restore the selected item of the trash to the path it was deleted from
+func (t *trashView) restore(s *Screen) {
+	if len(t.items) == 0 {
+		return
+	}
+	item := t.items[t.idx]
+	if err := item.Restore(); err != nil {
+		s.setError(err)
+		return
+	}
+	t.items = append(t.items[:t.idx], t.items[t.idx+1:]...)
+	t.idx = max(0, min(len(t.items)-1, t.idx))
+	s.refreshItems([]string{item.Path})
+	s.setStatus("Restored " + item.Path)
+}
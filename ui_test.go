@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nsf/termbox-go"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+var update = flag.Bool("update", false, "Update the golden files of the UI tests")
+
+// The files that the UI tests are run in, the screen starts in /home/user/project
+var uiFS = fstest.MapFS{
+	"home/user/notes.txt":                   &fstest.MapFile{},
+	"home/user/project/.git/HEAD":           &fstest.MapFile{},
+	"home/user/project/README.md":           &fstest.MapFile{Data: []byte("# Project\n\nA project to test the screen.\n")},
+	"home/user/project/go.mod":              &fstest.MapFile{},
+	"home/user/project/cmd/main.go":         &fstest.MapFile{},
+	"home/user/project/src/handler.go":      &fstest.MapFile{},
+	"home/user/project/src/handler_test.go": &fstest.MapFile{},
+	"home/user/project/src/main.go":         &fstest.MapFile{},
+	"home/user/project/src/util/strings.go": &fstest.MapFile{},
+	"home/user/project/src/日本語.txt":         &fstest.MapFile{},
+	"home/user/other/file":                  &fstest.MapFile{},
+}
+
+// Returns the events of the keys of a key sequence, such as "/main<Enter>"
+func keyEvents(t *testing.T, seq string) []termbox.Event {
+	keys, err := parseKeySequence(seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []termbox.Event
+	for _, name := range keys {
+		ev := termbox.Event{Type: termbox.EventKey}
+		if strings.HasPrefix(name, "<") && len(name) > 1 {
+			name = name[1 : len(name)-1]
+			if key, ok := specialKeys[name]; ok {
+				ev.Key = key
+			} else {
+				ev.Key = termbox.KeyCtrlA + termbox.Key(name[2]-'a')
+			}
+		} else {
+			ev.Ch = []rune(name)[0]
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// The letters that the colors of the cells are written as in the golden files. Characters that
+// matched the filter are written in upper case.
+var colorLetters = map[termbox.Attribute]rune{
+	termbox.ColorDefault: ' ',
+	termbox.ColorBlack:   'k',
+	termbox.ColorRed:     'r',
+	termbox.ColorGreen:   'g',
+	termbox.ColorYellow:  'y',
+	termbox.ColorBlue:    'b',
+	termbox.ColorMagenta: 'm',
+	termbox.ColorCyan:    'c',
+	termbox.ColorWhite:   'w',
+}
+
+// Returns the characters of the screen followed by their colors, one letter for each character
+func renderGrid(r *memRenderer, matchAttr termbox.Attribute) string {
+	var colors strings.Builder
+	for y := 0; y < r.height; y++ {
+		var line strings.Builder
+		for x := 0; x < r.width; x++ {
+			cell := r.Cell(x, y)
+			letter, ok := colorLetters[cell.Fg&^matchAttr]
+			if !ok {
+				letter = '?'
+			}
+			if cell.Fg&matchAttr != 0 {
+				letter = []rune(strings.ToUpper(string(letter)))[0]
+			}
+			line.WriteRune(letter)
+			// Like the characters, a wide character has the color of the cell it is drawn in
+			x += max(runeWidth(cell.Ch), 1) - 1
+		}
+		colors.WriteString(strings.TrimRight(line.String(), " "))
+		colors.WriteByte('\n')
+	}
+	return r.String() + strings.Repeat("-", r.width) + "\n" + colors.String()
+}
+
+func TestUI(t *testing.T) {
+	cases := []struct {
+		name   string
+		keys   string
+		resize []int // The width and height the terminal is resized to after the keys
+	}{
+		{name: "start"},
+		{name: "descend", keys: "<Down><Right><Down>"},
+		{name: "ascend", keys: "<Left>"},
+		{name: "hidden", keys: "h"},
+		{name: "filter", keys: "<Down><Right>/hand"},
+		{name: "filter_confirmed", keys: "<Down><Right>/main<Enter><C-o>"},
+		{name: "filter_error", keys: "/r:[a"},
+		{name: "permissions", keys: "p"},
+		{name: "preview", keys: "<Down>v"},
+		{name: "sort", keys: "sS"},
+		{name: "help", keys: "<C-h>"},
+		{name: "wide_names", keys: "<Down><Right><End>"},
+		{name: "resize", keys: "<End>", resize: []int{40, 6}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir, err := ctx.CreateDirectoryChainFS(uiFS, "/home/user/project")
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := defaultConfig()
+			config.LSColors = false
+			r := newMemRenderer(60, 12)
+			s := newScreen(dir, r, config)
+			s.keymap, _ = newKeymap("default", nil)
+
+			// Draw after each event, like the main loop does
+			s.draw()
+			var events []termbox.Event
+			if c.keys != "" {
+				events = keyEvents(t, c.keys)
+			}
+			if c.resize != nil {
+				r.Resize(c.resize[0], c.resize[1])
+				events = append(events, r.PollEvent())
+			}
+			for _, ev := range events {
+				if cmd := s.handleEvent(ev); cmd != nil {
+					t.Fatal(fmt.Sprintf("Expected the keys not to exit, found %s", cmd.FullCommand()))
+				}
+				s.draw()
+			}
+
+			found := renderGrid(r, s.matchAttr)
+			golden := filepath.Join("testdata", "golden", c.name+".golden")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, []byte(found), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != string(expected) {
+				t.Error(fmt.Sprintf("Expected the screen to be\n%s\nfound\n%s", expected, found))
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+// The rows of the tree that fit on the screen
+type viewport struct {
+	top    int // First row of the tree that is visible
+	height int // Number of rows that are visible
+	margin int // Rows kept visible above and below the selected row, when there are any
+}
+
+// Scroll as little as possible to keep the selected row at least margin rows away from the top and
+// bottom of the viewport, without scrolling past the last of the rows of the tree
+func (v *viewport) follow(selected, rows int) {
+	if v.height <= 0 {
+		v.top = 0
+		return
+	}
+	margin := min(v.margin, (v.height-1)/2)
+	if selected-margin < v.top {
+		v.top = selected - margin
+	}
+	if selected+margin >= v.top+v.height {
+		v.top = selected + margin - v.height + 1
+	}
+	v.top = max(0, min(v.top, rows-v.height))
+}
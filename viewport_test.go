@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+func TestViewportFollow(t *testing.T) {
+	cases := []struct {
+		top, height, margin int
+		selected, rows      int
+		expected            int
+	}{
+		{0, 10, 3, 0, 100, 0},
+		{0, 10, 3, 6, 100, 0},
+		{0, 10, 3, 7, 100, 1},    // Scrolls down to keep 3 rows below the selector
+		{20, 10, 3, 22, 100, 19}, // Scrolls up to keep 3 rows above the selector
+		{20, 10, 3, 25, 100, 20}, // Does not scroll while the selector is away from the edges
+		{0, 10, 3, 98, 100, 90},  // Does not scroll past the last row
+		{50, 10, 3, 5, 8, 0},     // The tree became shorter than the screen
+		{0, 4, 3, 3, 100, 1},     // The margin is limited to half of the height
+		{0, 10, 0, 9, 100, 0},
+		{0, 0, 3, 5, 100, 0},
+	}
+	for _, c := range cases {
+		v := viewport{top: c.top, height: c.height, margin: c.margin}
+		v.follow(c.selected, c.rows)
+		if v.top != c.expected {
+			t.Error(fmt.Sprintf("Expected %+v to scroll to %d for row %d of %d, found %d", c, c.expected, c.selected, c.rows, v.top))
+		}
+	}
+}
+
+func TestDrawClipsLevels(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for ii := 0; ii < 30; ii++ {
+		fsys[fmt.Sprintf("root/dir%02d/file%02d", ii, ii)] = &fstest.MapFile{}
+	}
+	base, err := ctx.NewDirectoryFS(fsys, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Screen{CurrentDir: base, renderer: newMemRenderer(200, 12), scrollMargin: 2}
+	if err := s.jumpTo(base, "dir20/file20"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.drawDirContents(0, 2, 200, 12, s.getDirView(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 of the 30 rows fit, the selected file is on row 20 and 2 rows are kept below it
+	if s.view.top != 13 {
+		t.Error(fmt.Sprintf("Expected the view to start at row 13, found %d", s.view.top))
+	}
+	rowsUsed := make(map[int]bool)
+	for _, h := range s.hitboxes {
+		if h.y < 2 || h.y >= 12 {
+			t.Error(fmt.Sprintf("Expected nothing to be drawn outside of rows 2 to 11, found %s on row %d", h.dir.Files[h.idx].Name(), h.y))
+		}
+		if h.dir == base {
+			if rowsUsed[h.y] {
+				t.Error(fmt.Sprintf("Expected one item of the upper level on row %d", h.y))
+			}
+			rowsUsed[h.y] = true
+		}
+	}
+	if len(rowsUsed) != 10 {
+		t.Error(fmt.Sprintf("Expected the upper level to fill the 10 rows, found %d", len(rowsUsed)))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Returns the number of cells that a rune takes on the screen. Wide characters, such as CJK and most
+// emoji, take two cells. Characters without a width of their own, such as combining marks, take none:
+// a termbox cell holds a single rune so they are not drawn. Control characters take a cell, like
+// termbox gives them.
+func runeWidth(r rune) int {
+	w := runewidth.RuneWidth(r)
+	switch {
+	case w == 0 && unicode.IsControl(r):
+		return 1
+	case w == 2 && runewidth.IsAmbiguousWidth(r):
+		// termbox draws characters of ambiguous width in a single cell
+		return 1
+	}
+	return w
+}
+
+// Returns the number of cells that a string takes on the screen
+func stringWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+// Returns the number of cells taken by the first n runes of a string
+func runesWidth(s string, n int) int {
+	w := 0
+	for _, r := range s {
+		if n == 0 {
+			break
+		}
+		w += runeWidth(r)
+		n--
+	}
+	return w
+}
+
+// Shorten the text to fit in the width. A wide character that would be cut in half is left out,
+// along with the combining marks that follow it.
+func truncate(text string, width int) string {
+	w := 0
+	for ii, r := range text {
+		w += runeWidth(r)
+		if w > width {
+			return text[:ii]
+		}
+	}
+	return text
+}
+
+// Replace the control characters of a string, which would move the cursor or change the colors of a
+// terminal, with dots
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '.'
+		}
+		return r
+	}, s)
+}
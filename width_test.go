@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lobocv/itree/ctx"
+)
+
+func TestStringWidth(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected int
+	}{
+		{"", 0},
+		{"file.txt", 8},
+		{"日本語.txt", 10},
+		{"café", 4}, // e followed by a combining accent
+		{"🎉party", 7},
+		{"├─└─", 4},
+		{"a\tb", 3},
+	}
+	for _, c := range cases {
+		if found := stringWidth(c.text); found != c.expected {
+			t.Error(fmt.Sprintf("Expected the width of %q to be %d, found %d", c.text, c.expected, found))
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		text     string
+		width    int
+		expected string
+	}{
+		{"file.txt", 20, "file.txt"},
+		{"file.txt", 4, "file"},
+		{"file.txt", 0, ""},
+		{"日本語.txt", 4, "日本"},
+		{"日本語.txt", 5, "日本"}, // The third character does not fit in the last cell
+		{"cafés", 4, "café"},
+		{"🎉🎉", 3, "🎉"},
+	}
+	for _, c := range cases {
+		found := truncate(c.text, c.width)
+		if found != c.expected {
+			t.Error(fmt.Sprintf("Expected %q truncated to %d to be %q, found %q", c.text, c.width, c.expected, found))
+		}
+		if stringWidth(found) > c.width {
+			t.Error(fmt.Sprintf("Expected %q to fit in %d cells", found, c.width))
+		}
+	}
+}
+
+func TestDrawWideNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/日本語のディレクトリ/file": &fstest.MapFile{},
+		"root/café": &fstest.MapFile{},
+		"root/🎉":     &fstest.MapFile{},
+	}
+	base, err := ctx.NewDirectoryFS(fsys, "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Screen{CurrentDir: base, renderer: newMemRenderer(200, 20), maxLevelWidth: 10}
+	if err := s.jumpTo(base, "日本語のディレクトリ/file"); err != nil {
+		t.Fatal(err)
+	}
+	dirlist := s.getDirView(1)
+	if err := s.drawDirContents(0, 2, 200, 20, dirlist); err != nil {
+		t.Fatal(err)
+	}
+
+	widths := make(map[string]int)
+	var fileX int
+	for _, h := range s.hitboxes {
+		name := h.dir.Files[h.idx].Name()
+		widths[name] = h.x1 - h.x0
+		if h.dir != base {
+			fileX = h.x0
+		}
+	}
+	expected := map[string]int{
+		"café": 4,
+		"🎉":     2,
+		// Truncated to 7 cells, the next character is wide and does not fit, then "..." and "/"
+		"日本語のディレクトリ": 10,
+		"file":       4,
+	}
+	for name, w := range expected {
+		if widths[name] != w {
+			t.Error(fmt.Sprintf("Expected %q to take %d cells, found %d", name, w, widths[name]))
+		}
+	}
+	// The next level starts after the width limit of the level above it, the spacing and the line to it
+	if expectedX := 10 + 2 + 2 + 2; fileX != expectedX {
+		t.Error(fmt.Sprintf("Expected file to be drawn at column %d, found %d", expectedX, fileX))
+	}
+}
+
+func TestPrintable(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected string
+	}{
+		{"plain 日本語", "plain 日本語"},
+		{"a.go:3: \x1b[31mred\x1b[0m", "a.go:3: .[31mred.[0m"},
+		{"carriage\rreturn\x00\x7f", "carriage.return.."},
+	}
+	for _, c := range cases {
+		if out := printable(c.text); out != c.expected {
+			t.Error(fmt.Sprintf("Expected %q, found %q", c.expected, out))
+		}
+	}
+}